@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// range of IP addresses announced by autonomous system
+type asnRange struct {
+	start, end net.IP // 16-byte form, for comparison
+	asn        uint32
+	org        string
+}
+
+// offline IP-to-ASN database, ranges are sorted by start address
+type asnDB struct {
+	ranges []asnRange
+}
+
+// loads IP-to-ASN database from file (or http/https URL) in iptoasn.com TSV format (optionally gzipped):
+// range_start, range_end, AS_number, country_code, AS_description.
+// cancellation of ctx interrupts download
+func loadASNDB(ctx context.Context, path string) (*asnDB, error) {
+	f, err := openASNSource(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	db := &asnDB{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		start, end := net.ParseIP(fields[0]), net.ParseIP(fields[1])
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if start == nil || end == nil || err != nil {
+			return nil, fmt.Errorf("%s:%d: malformed ASN range", path, line)
+		}
+
+		// ranges of AS0 are not routed
+		if asn == 0 {
+			continue
+		}
+
+		rng := asnRange{start: start.To16(), end: end.To16(), asn: uint32(asn)}
+		if len(fields) > 4 {
+			rng.org = fields[4]
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// HTTP client to download ASN database with: timeout covers the whole download, body included
+var asnClient = &http.Client{Timeout: 5 * time.Minute}
+
+// opens file or downloads URL of ASN database
+func openASNSource(ctx context.Context, path string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return os.Open(path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := asnClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// finds range, containing ip. returns false if ip is not found in database
+func (db *asnDB) lookup(ip net.IP) (asnRange, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return asnRange{}, false
+	}
+
+	// first range that starts after ip
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	})
+	if i == 0 {
+		return asnRange{}, false
+	}
+
+	rng := db.ranges[i-1]
+	if bytes.Compare(ip, rng.end) > 0 {
+		return asnRange{}, false
+	}
+	return rng, true
+}
+
+// matches AS number, given as input: AS13335 (case-insensitive)
+var asnRegexp = regexp.MustCompile(`^(?i)AS(\d+)$`)
+
+// parses AS number, given as input. reports whether input is one
+func parseASN(s string) (uint32, bool) {
+	m := asnRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	asn, err := strconv.ParseUint(m[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(asn), true
+}
+
+// returns CIDR prefixes, covering all ranges of AS. overlapping and adjacent ranges are merged first,
+// so that no IP is covered twice
+func (db *asnDB) prefixes(asn uint32) []string {
+	// ranges are sorted by start
+	var merged []asnRange
+	for _, rng := range db.ranges {
+		if rng.asn != asn {
+			continue
+		}
+		if n := len(merged); n > 0 && isIPv4(merged[n-1].start) == isIPv4(rng.start) &&
+			bytes.Compare(rng.start, nextIP(merged[n-1].end)) <= 0 {
+			if bytes.Compare(rng.end, merged[n-1].end) > 0 {
+				merged[n-1].end = rng.end
+			}
+			continue
+		}
+		merged = append(merged, rng)
+	}
+
+	var prefixes []string
+	for _, rng := range merged {
+		prefixes = append(prefixes, rangeCIDRs(rng.start, rng.end)...)
+	}
+	return prefixes
+}
+
+// reports whether 16-byte form of IP is one of IPv4
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+// returns IP, following ip (the same one for the last IP of address space)
+func nextIP(ip net.IP) net.IP {
+	next := new(big.Int).Add(new(big.Int).SetBytes(ip), big.NewInt(1))
+	if next.BitLen() > 128 {
+		return ip
+	}
+	return net.IP(next.FillBytes(make([]byte, net.IPv6len)))
+}
+
+// returns minimal list of CIDRs, that exactly covers range of IPs (16-byte form) from start to end
+func rangeCIDRs(start, end net.IP) []string {
+	bits := 128
+	if isIPv4(start) {
+		bits = 32
+	}
+
+	// IPv4 is handled in 16-byte form, its prefixes are counted from 96 bits
+	first, last := new(big.Int).SetBytes(start), new(big.Int).SetBytes(end)
+	one := big.NewInt(1)
+
+	var cidrs []string
+	for first.Cmp(last) <= 0 {
+		// the largest block, aligned at first, that does not go past last
+		size := int(first.TrailingZeroBits())
+		if first.Sign() == 0 || size > bits {
+			size = bits
+		}
+		for size > 0 && new(big.Int).Add(first, new(big.Int).Lsh(one, uint(size))).Cmp(new(big.Int).Add(last, one)) > 0 {
+			size--
+		}
+
+		ip := net.IP(first.FillBytes(make([]byte, net.IPv6len)))
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", ip, bits-size))
+		first.Add(first, new(big.Int).Lsh(one, uint(size)))
+	}
+	return cidrs
+}
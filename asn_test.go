@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testASNData = "" +
+	"1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"127.0.0.0\t127.255.255.255\t64512\tZZ\tTEST-ORG\n" +
+	"2001:db8::\t2001:db8::ffff\t64513\tZZ\tTEST-ORG-V6\n"
+
+func Test_asnDB_lookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.tsv")
+	if err := os.WriteFile(path, []byte(testASNData), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := loadASNDB(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip    string
+		found bool
+		asn   uint32
+	}{
+		{"1.0.0.0", true, 13335},
+		{"1.0.0.255", true, 13335},
+		{"1.0.1.1", false, 0}, // not routed
+		{"0.0.0.1", false, 0},
+		{"127.0.0.1", true, 64512},
+		{"200.0.0.1", false, 0},
+		{"2001:db8::1", true, 64513},
+		{"2001:db8::1:0", false, 0},
+	}
+
+	for _, c := range cases {
+		rng, found := db.lookup(net.ParseIP(c.ip))
+		assert.Equal(t, c.found, found, c.ip)
+		assert.Equal(t, c.asn, rng.asn, c.ip)
+	}
+}
+
+func Test_loadASNDB_malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.tsv")
+	if err := os.WriteFile(path, []byte("1.0.0.0\tgibberish\t13335\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadASNDB(context.Background(), path)
+	assert.Error(t, err)
+}
+
+func Test_loadASNDB_URL(t *testing.T) {
+	// server, that stalls until client goes away
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/asn.tsv" {
+			_, _ = w.Write([]byte(testASNData))
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	db, err := loadASNDB(context.Background(), ts.URL+"/asn.tsv")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"1.0.0.0/24"}, db.prefixes(13335))
+	}
+
+	// stalled download is interrupted by cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = loadASNDB(ctx, ts.URL+"/stalled.tsv")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func Test_parseASN(t *testing.T) {
+	cases := []struct {
+		input string
+		asn   uint32
+		ok    bool
+	}{
+		{"AS13335", 13335, true},
+		{"as64512", 64512, true},
+		{"AS", 0, false},
+		{"AS4294967296", 0, false}, // out of 32-bit range
+		{"AS13335.example.com", 0, false},
+		{"13335", 0, false},
+	}
+	for _, c := range cases {
+		asn, ok := parseASN(c.input)
+		assert.Equal(t, c.ok, ok, c.input)
+		assert.Equal(t, c.asn, asn, c.input)
+	}
+}
+
+func Test_asnDB_prefixes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.tsv")
+	data := testASNData +
+		// overlapping and adjacent ranges of the same AS
+		"10.0.0.0\t10.0.0.127\t64514\tZZ\tTEST\n" +
+		"10.0.0.64\t10.0.0.255\t64514\tZZ\tTEST\n" +
+		"10.0.1.0\t10.0.1.2\t64514\tZZ\tTEST\n" +
+		"2001:db8:1::\t2001:db8:1::ffff:ffff:ffff:ffff\t64514\tZZ\tTEST\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := loadASNDB(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"1.0.0.0/24"}, db.prefixes(13335))
+	assert.Equal(t, []string{"2001:db8::/112"}, db.prefixes(64513))
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/31", "10.0.1.2/32", "2001:db8:1::/64"}, db.prefixes(64514))
+	assert.Empty(t, db.prefixes(1))
+}
+
+func Test_rangeCIDRs(t *testing.T) {
+	cases := []struct {
+		start, end string
+		expected   []string
+	}{
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"10.0.0.1", "10.0.0.1", []string{"10.0.0.1/32"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"::", "::1", []string{"::/127"}},
+		{"2001:db8::ff", "2001:db8::100", []string{"2001:db8::ff/128", "2001:db8::100/128"}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, rangeCIDRs(net.ParseIP(c.start).To16(), net.ParseIP(c.end).To16()), c.start)
+	}
+}
@@ -2,30 +2,206 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+	"golang.org/x/time/rate"
 )
 
+/* input item (argument or line of input file), numbered in order of input */
+type inputItem struct {
+	id   uint64 // starts at 1
+	text string
+}
+
+/* atomic target to process */
+type procTarget struct {
+	id         uint64 // input item, the target originates from (of the result it was discovered in, when recursing)
+	addr       string
+	serverName string   // domain name, that IP of addr was resolved from (only if all IPs are resolved)
+	sni        string   // SNI given with input item as '@servername' suffix, overrides -sni
+	hostPorts  int      // number of ports to process on the same host
+	nextPorts  []string // ports of the same host to try next, if this one yields no certificate (with -first-port)
+	depth      int      // recursion depth, the target was discovered at (0 for input targets)
+}
+
+/* certificate of the chain, presented by the server */
+type chainCert struct {
+	subject string
+	issuer  string
+	names   []string
+}
+
 /* result of processing a domain name */
 type procResult struct {
-	addr  string
-	names []string
-	err   error
+	id          uint64 // input item, the result originates from
+	addr        string
+	hostPorts   int
+	depth       int
+	ts          time.Time // time the result was produced at
+	names       []string
+	notBefore   time.Time
+	notAfter    time.Time
+	issuerCN    string
+	issuerOrg   []string
+	issuerClass string      // coarse class of issuer, see classifyIssuer
+	sha256      string      // hex fingerprint of leaf certificate
+	version     uint16      // negotiated TLS version
+	cipher      uint16      // negotiated cipher suite
+	alpn        string      // negotiated application protocol (only if ALPN is requested)
+	chain       []chainCert // every certificate of the chain, leaf first (only if full chain is requested)
+	certs       [][]byte    // DER of leaf (of every certificate of the chain, with full chain), only if certificates are dumped
+	cert        *jsonCert   // metadata of leaf (only if certificate JSON export is requested)
+	remote      string      // address actually dialed
+	pubKeyAlg   x509.PublicKeyAlgorithm
+	pubKeyBits  int
+	selfSigned  bool   // whether leaf is signed by itself
+	hostname    string // domain name, leaf was checked against (empty for IPs)
+	hostMatch   bool   // whether leaf is valid for hostname
+	asn         uint32 // autonomous system of scanned IP (only if ASN lookup is requested)
+	asOrg       string
+	ptr         []string // names of scanned IP from PTR records (only if reverse lookup is requested)
+	sni         string   // SNI picked from pool (only with -sni-pool)
+	estimate    string   // numbers of IPs and targets, the block expands to (only in dry run)
+	verifyErr   error    // chain verification error (only if verification is requested)
+	err         error
 }
 
 // run parameters (filled from CLI arguments)
 var (
-	verbose              bool
-	concurrency          int
-	defaultPorts         []string
-	timeout              int
-	onlyValidDomainNames bool
+	options          cero.Options // options of certificate grabbing
+	verbose          bool
+	quiet            bool
+	showErrors       bool
+	concurrency      int
+	concurrencyLevel string
+	inputConcurrency int
+	timeout          int
+	handshakeTimeout int
+	runDeadline      time.Duration
+	retries          int
+	connRate         float64
+	verify           bool
+	caRoots          *x509.CertPool // roots to verify chains against (nil for system ones)
+	rrOutput         bool
+	expiredOnly      bool
+	weakKeys         bool
+	selfSignedOnly   bool
+	expiringDays     int
+	issuerFilter     string
+	issuerClassOnly  string
+	uniqueCerts      bool
+	asnLookup        string
+	asnDatabase      *asnDB
+	asnPrefixes      *asnDB // database to expand AS inputs with (defaults to asnDatabase)
+	reverseLookup    bool
+	outDir           string
+	dumpDir          string
+	groupHost        bool
+	jsonOutput       bool
+	ndjsonOutput     bool
+	outputTemplate   *template.Template // template to output results with (nil for built-in formats)
+	csvOutput        bool
+	csvPerHost       bool // one CSV row for every address, instead of every name
+	certJSON         bool
+	maxTargets       int
+	dryRun           bool
+	listOnly         bool
+	assumeYes        bool
+	shuffle          bool
+	skipEdges        bool     // skip network and broadcast addresses of IPv4 CIDRs
+	firstPort        bool     // try ports of host one by one, until one of them yields certificate
+	sniPool          []string // SNIs to pick from at random for every target
+	showIDs          bool     // output numbers of input items along with results
+	resolveAll       bool
+	showAddr         bool
+	printStats       bool
+	exitStatus       bool
+	showProgress     bool
+	errorsOnly       map[string]bool // classes of errors to output exclusively (nil for all results)
+	outFile          *os.File        // destination of results
+	uniqueNames      bool
+	dedupeTargets    bool
+	sortNames        bool
+	matchDomains     []string // parent domains, names must belong to (normalized)
+	grepNames        *regexp.Regexp
+	grepOutNames     *regexp.Regexp
+	recurse          bool
+	maxDepth         int
+)
+
+// atomic targets fed to workers and skipped because of -max limit (shared by input goroutines)
+var fedTargets, skippedTargets uint64
+
+// atomic targets already fed, and number of targets skipped as their duplicates (with -dedupe-targets)
+var (
+	fedSet           *targetSet
+	duplicateTargets uint64
+)
+
+// targets sent to workers (and errors sent to output), which results are not yet processed by output.
+// in recursive mode, processing a result may feed new targets, so input is closed only when this drops to zero
+var pending sync.WaitGroup
+
+// normalized domain names already fed as targets (in recursive mode)
+var visited = struct {
+	sync.Mutex
+	names map[string]struct{}
+}{names: make(map[string]struct{})}
+
+// resolves domain names (replaced in tests)
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// lookups of domain names within the run (with lookupIPAddr)
+var dnsLookups *dnsCache
+
+// looks up names of IP (replaced in tests)
+var lookupAddr = net.DefaultResolver.LookupAddr
+
+// reverse lookups of scanned IPs within the run (with lookupAddr), nil unless requested with -ptr
+var ptrLookups *ptrCache
+
+// grabs certificates (replaced in tests)
+var grabCert = cero.GrabCert
+
+// exits the process with code (replaced in tests)
+var exit = os.Exit
+
+// size of output buffer: millions of names are written in large chunks, instead of a write per name.
+// errors on standard error are never buffered
+const outputBufferSize = 64 << 10
+
+// exit codes: invalid arguments or startup failure (flag package uses the same code),
+// no certificate grabbed (only with -exit-status), run stopped by exceeded deadline
+const (
+	exitFailed     = 1
+	exitUsage      = 2
+	exitIncomplete = 3
 )
 
 var usage = "" +
@@ -35,13 +211,98 @@ if [targets] not provided in commandline arguments, will read from stdin
 
 func main() {
 	// parse CLI arguments
-	var ports string
+	var ports, proxyURL, resolvers, dohURL, certFile, keyFile, caFile, errorClasses, outPath, domains, grep, grepOut, minVersion, maxVersion, alpn, format, csvPer, asnSource, issuerClassesPath, portFile, source, sniPoolList string
+	var inputFiles listFlag
+	var printVersion bool
 
-	flag.BoolVar(&verbose, "v", false, `Be verbose: Output results as 'addr -- [result list]', output errors to stderr as 'addr -- error message'`)
-	flag.IntVar(&concurrency, "c", 100, "Concurrency level")
-	flag.StringVar(&ports, "p", "443", "TLS ports to use, if not specified explicitly in host address. Use comma-separated list")
+	flag.BoolVar(&verbose, "v", false, `Be verbose: Output results as 'addr -- [result list]', output errors to stderr as 'addr -- class: error message'`)
+	flag.BoolVar(&printVersion, "version", false, "Print version, git commit and Go version of the build, and exit")
+	flag.BoolVar(&quiet, "q", false, "Be quiet: do not output errors at all (even in verbose, JSON and other modes), only successful results. Errors are still counted by -stats")
+	flag.BoolVar(&quiet, "silent", false, "Same as -q")
+	flag.BoolVar(&showErrors, "show-errors", false, "Output errors to stderr as 'addr -- class: error message' in non-verbose mode too (stdout is still limited to names)")
+	flag.StringVar(&alpn, "alpn", "", "Application protocols to advertise with ALPN (comma-separated, e.g. h2,http/1.1), and report the negotiated one")
+	flag.StringVar(&asnLookup, "asn-lookup", "", "Path to IP-to-ASN database (iptoasn.com TSV format, optionally gzipped) to annotate scanned IPs with ASN and its owner")
+	flag.StringVar(&asnSource, "asn-source", "", "Path or URL of IP-to-ASN database (iptoasn.com TSV format, optionally gzipped) to expand AS inputs (e.g. AS13335) into prefixes they announce. Defaults to database of -asn-lookup")
+	flag.StringVar(&concurrencyLevel, "c", "100", fmt.Sprintf("Concurrency level, or 'auto' for half the limit of open files (at most %d). Concurrency is lowered, when open files are exhausted", maxAutoConcurrency))
+	flag.BoolVar(&options.IDN, "idn", false, "Output internationalized domain names in Unicode (decode punycode labels), and consider them valid with -d")
+	flag.BoolVar(&options.FullChain, "full-chain", false, "Output names of every certificate of the chain, not only of leaf (in verbose mode, also output names of every certificate separately)")
+	flag.BoolVar(&options.CommonNameOnly, "cn-only", false, "Output only CommonName of certificate, not its SANs (names are still filtered with -d)")
+	flag.BoolVar(&options.SANsOnly, "sans-only", false, "Output only SANs of certificate, not its CommonName (unless it's among SANs too)")
+	flag.BoolVar(&options.IncludeIPSANs, "include-ip-sans", false, "Output IP addresses from SANs of certificate as well (even with -d)")
+	flag.Var(&inputFiles, "i", "File to read targets from, line by line ('-' for stdin). Comments (# to the end of line, at its start or after whitespace) are skipped. Can be repeated")
+	flag.IntVar(&inputConcurrency, "ic", 1, "Concurrency level of input processing (parsing and CIDR expansion)")
+	flag.StringVar(&ports, "p", "443", "TLS ports to use, if not specified explicitly in host address. Use comma-separated list, ranges are allowed: 443,8443,9000-9100")
+	flag.BoolVar(&firstPort, "first-port", false, "Try ports of every host in order, and stop at the first one that yields certificate (e.g. with -p 443,8443, skip 8443 if 443 answered). Only result of the last port tried is output")
+	flag.StringVar(&portFile, "port-file", "", "File to read TLS ports from, line by line (in the same format as -p). Comments are skipped. Combined with -p, if both are given")
+	flag.StringVar(&domains, "match-domain", "", "Output only names that belong to specified parent domains (comma-separated), e.g. example.com matches example.com and www.example.com")
+	flag.StringVar(&minVersion, "min-version", "", "Minimum TLS version to offer: 1.0, 1.1, 1.2 or 1.3 (to probe hosts that still support legacy TLS, set it to 1.0)")
+	flag.StringVar(&maxVersion, "max-version", "", "Maximum TLS version to offer: 1.0, 1.1, 1.2 or 1.3")
+	flag.IntVar(&maxTargets, "max", 0, "Maximum number of atomic targets (host:port) to process, the rest of input is skipped (0 for no limit)")
+	flag.BoolVar(&options.NoSNI, "no-sni", false, "Do not send SNI for domain names (get default certificate of the host)")
+	flag.StringVar(&outPath, "o", "", "File to write results to, instead of standard output (in verbose mode, errors are written there too)")
+	flag.StringVar(&outDir, "out-dir", "", "Directory to write result of every target into its own file (created if absent)")
+	flag.BoolVar(&showAddr, "show-addr", false, "Output address actually dialed along with names: 'name [ip:port]' (in verbose and JSON modes, as separate field)")
+	flag.BoolVar(&shuffle, "shuffle", false, "Expand CIDRs and IP ranges in pseudo-random order, instead of ascending one")
+	flag.BoolVar(&showIDs, "ids", false, "Output number of input item (argument or line of input, counted from 1 in order of input), every result originates from, to correlate results with inputs (in verbose and JSON modes). Results of recursion get number of the input, they were discovered from")
+	flag.StringVar(&sniPoolList, "sni-pool", "", "SNIs to send (comma-separated), every target gets one of them at random, e.g. to test default virtual hosts of CDN or SNI filtering. SNI sent is output in verbose, JSON and template modes")
+	flag.StringVar(&options.SNI, "sni", "", "SNI to send to every target, regardless of its address (including IPs and CIDRs)")
+	flag.BoolVar(&showProgress, "progress", false, "Report progress to stderr every 2 seconds: targets done and enqueued, rate and ETA (when number of targets is known)")
+	flag.BoolVar(&exitStatus, "exit-status", false, "Reflect outcome in exit code: 0 if at least one certificate was grabbed, 1 if none was (all targets failed, or there were none), 2 for invalid arguments")
+	flag.BoolVar(&printStats, "stats", false, "Print summary of the run to stderr when done: targets processed, successful grabs, errors by class, unique names and duration")
+	flag.BoolVar(&options.QUIC, "quic", false, "Grab certificates with QUIC handshake over UDP (HTTP/3 services), instead of TLS over TCP. Advertises h3, unless -alpn is set. Can not be combined with -starttls, -auto-starttls, -mimic or -proxy")
+	flag.StringVar(&options.STARTTLS, "starttls", "", "Negotiate TLS over plaintext protocol with STARTTLS: "+starttlsUsage())
+	flag.BoolVar(&options.AutoSTARTTLS, "auto-starttls", false, "Negotiate STARTTLS by port: ftp on 21, smtp on 25 and 587, pop3 on 110, imap on 143, ldap on 389, xmpp on 5222, postgres on 5432, plain TLS on other ports")
+	flag.StringVar(&source, "source", "", "Local IP to connect from, on multi-homed hosts (IPv6 link-local one with zone, e.g. fe80::1%eth0)")
+	flag.StringVar(&proxyURL, "proxy", "", "SOCKS5 proxy to connect through: socks5://[user:password@]host:port")
 	flag.IntVar(&timeout, "t", 4, "TLS Connection timeout in seconds")
-	flag.BoolVar(&onlyValidDomainNames, "d", false, "Output only valid domain names (e.g. strip IPs, wildcard domains and gibberish)")
+	flag.DurationVar(&runDeadline, "deadline", 0, "Limit duration of the whole run, e.g. 10m: when it's exceeded, processing stops, and cero exits with code 3 (in verbose mode, number of unprocessed targets is reported)")
+	flag.IntVar(&handshakeTimeout, "handshake-timeout", 0, "Timeout of TLS handshake (and STARTTLS negotiation) in seconds, counted from connection (0 for the same as -t)")
+	flag.StringVar(&resolvers, "resolver", "", "DNS servers to resolve domain names with, instead of system ones (comma-separated host:port, port 53 if omitted). Servers are used in order of failover")
+	flag.StringVar(&dohURL, "doh", "", "DNS-over-HTTPS endpoint to resolve domain names with, instead of system DNS servers, e.g. https://cloudflare-dns.com/dns-query (requests are limited by -t)")
+	flag.BoolVar(&reverseLookup, "ptr", false, "Look up names of scanned IPs in PTR records (with -resolver or -doh, if set), and output them in verbose, JSON and template modes. Lookups are done once per IP, failed ones yield no names")
+	flag.BoolVar(&resolveAll, "resolve-all", false, "Resolve domain names to all of their IPs and grab certificate from every IP (sending domain name as SNI)")
+	flag.BoolVar(&recurse, "recurse", false, "Feed valid domain names, found in certificates, back as targets: every new name is resolved and its IPs are dialed on default ports, sending the name as SNI")
+	flag.IntVar(&maxDepth, "depth", 1, "Maximum depth of recursion (with -recurse)")
+	flag.Float64Var(&connRate, "rate", 0, "Limit rate of connections per second, retries included (0 for no limit). Unlike -c, that caps number of connections in parallel, this caps their throughput")
+	flag.IntVar(&retries, "r", 1, "Number of retries of transient network failures, with exponential backoff (0 disables retries). By default timeouts are retried once, while connection resets are fatal, like refused connections. Setting -r explicitly retries resets too")
+	flag.IntVar(&retries, "retries", 1, "Alias for -r")
+	flag.BoolVar(&options.OnlyValidDomainNames, "d", false, "Output only valid domain names (e.g. strip IPs, wildcard domains and gibberish)")
+	flag.BoolVar(&options.Wildcards, "wildcards", false, "With -d, keep wildcard domain names (e.g. *.example.com)")
+	flag.BoolVar(&options.AllowUnderscore, "allow-underscore", false, "With -d, keep domain names with labels starting with underscore (e.g. _dmarc.example.com)")
+	flag.BoolVar(&options.StripTrailingDot, "strip-trailing-dot", false, "Output fully qualified names without trailing dot (example.com. as example.com), so that both forms are the same name for -unique")
+	flag.BoolVar(&options.StripWildcards, "strip-wildcards", false, "Output wildcard domain names as their base domain (*.example.com as example.com)")
+	flag.IntVar(&expiringDays, "expiring", 0, "Output only results with certificate expiring within specified number of days (including already expired)")
+	flag.StringVar(&dumpDir, "dump-dir", "", "Directory to write certificates into as PEM files, named after SHA-256 fingerprint of leaf (with -full-chain, the whole chain is written)")
+	flag.BoolVar(&skipEdges, "skip-network-broadcast", false, "Skip network and broadcast addresses (the first and the last one) of IPv4 CIDRs wider than /31")
+	flag.BoolVar(&listOnly, "list-only", false, "Do not connect, only output every target (host:port) that would be dialed, after expansion of CIDRs, IP ranges and ports (respects -shuffle, -max and -dedupe-targets)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Do not connect, only print number of IPs and targets every CIDR and IP range expands to")
+	flag.StringVar(&errorClasses, "errors-only", "", "Output only results that failed with specified classes of errors (comma-separated): "+strings.Join(cero.ErrorClasses, ", "))
+	flag.BoolVar(&weakKeys, "weak-keys", false, "Output only results with weak public key of certificate: RSA shorter than 2048 bits, ECDSA on curve smaller than 224 bits, or DSA")
+	flag.BoolVar(&selfSignedOnly, "self-signed-only", false, "Output only results with self-signed certificate (root CA presented after leaf does not count)")
+	flag.BoolVar(&expiredOnly, "expired-only", false, "Output only results with expired certificate (in verbose mode, also output how long ago it expired)")
+	flag.BoolVar(&jsonOutput, "json", false, "Output every result (including errors) as JSON record: {\"addr\", \"host\", \"port\", \"names\", \"error\", \"ts\"}")
+	flag.StringVar(&format, "format", "", "Output every result (including errors) with Go template, e.g. '{{.Addr}} {{join .Names \",\"}} {{.Issuer}} {{.NotAfter}}'. Fields: ID, Addr, Host, Port, Names, Error, ErrorClass, TS, NotBefore, NotAfter, Issuer, IssuerCN, IssuerOrg, SHA256, TLSVersion, CipherSuite, ALPN, RemoteAddr, Hostname, HostnameMatch, PubKeyAlg, PubKeyBits, SelfSigned, Verify, ASN, ASOrg, PTR, SNI. Overrides other output modes")
+	flag.BoolVar(&csvOutput, "csv", false, "Output results as CSV with header row: addr,host,port,name,issuer,not_after,error")
+	flag.StringVar(&csvPer, "csv-per", "name", "With -csv, output a row for every 'name', or for every 'host' address (with all of its names space-separated)")
+	flag.StringVar(&certFile, "cert", "", "Client certificate (PEM) to present to servers, that request one (mTLS), requires -key")
+	flag.StringVar(&keyFile, "key", "", "Private key (PEM) of client certificate, set with -cert")
+	flag.BoolVar(&certJSON, "cert-json", false, "Add full metadata of leaf certificate to every JSON record as \"cert\": subject, issuer, serial, validity, all kinds of SANs, algorithms and fingerprint (implies -json)")
+	flag.BoolVar(&ndjsonOutput, "ndjson", false, "Stream JSON records, flushing every record as soon as it is produced (implies -json)")
+	flag.StringVar(&issuerClassOnly, "issuer-class", "", "Output only results with certificate issuer of specified class: "+strings.Join(issuerClassLabels(defaultIssuerClasses), ", ")+" (or one of -issuer-classes)")
+	flag.StringVar(&issuerClassesPath, "issuer-classes", "", "File with table of issuer classes to use instead of built-in one: 'label: pattern, pattern...' at every line, patterns are matched against issuer CommonName and Organization (case-insensitive)")
+	flag.StringVar(&issuerFilter, "issuer-filter", "", "Output only results with certificate issuer CommonName or Organization containing specified substring (case-insensitive)")
+	flag.StringVar(&options.Mimic, "mimic", "", "Present ClientHello of a browser to evade fingerprint-based blocking: "+strings.Join(cero.MimicBrowsers(), ", "))
+	flag.BoolVar(&rrOutput, "rr", false, "Output results as DNS resource records 'name. IN A ip', only for targets specified by IP. Records are output at the end of the run, grouped by names (every name with all IPs it was found on)")
+	flag.StringVar(&grep, "grep", "", "Output only names matching regular expression")
+	flag.StringVar(&grepOut, "grep-v", "", "Output only names not matching regular expression")
+	flag.BoolVar(&groupHost, "group-host", false, "Group results of all ports of the same host: in verbose mode output them as 'host -- port: [result list] -- port: class: error message', in JSON mode as {\"host\", \"ports\": [...]}")
+	flag.BoolVar(&dedupeTargets, "dedupe-targets", false, "Process every atomic target (host:port) only once per run, even if it's given by several inputs (e.g. overlapping CIDRs). Targets already fed are kept in memory (compactly for IPv4)")
+	flag.BoolVar(&sortNames, "sort", false, "Output names sorted alphabetically, once all targets are processed (non-verbose mode). All names are kept in memory, so it's meant for bounded scans")
+	flag.BoolVar(&uniqueNames, "unique", false, "Output every name only once per run (case-insensitive, ignoring trailing dot). Names already printed are kept in memory")
+	flag.BoolVar(&uniqueCerts, "unique-certs", false, "Output only the first result for every distinct certificate (by SHA-256 fingerprint)")
+	flag.BoolVar(&assumeYes, "yes", false, fmt.Sprintf("Do not ask for confirmation before expanding CIDRs and IP ranges larger than %d IPs", hugeCIDRSize))
+	flag.BoolVar(&verify, "verify", false, "Verify certificate chain against system roots and report whether it's valid, or the reason of failure: expired, self-signed, hostname mismatch, untrusted root, etc. (in verbose and JSON modes)")
+	flag.StringVar(&caFile, "cafile", "", "PEM bundle of CA certificates to verify chains against, instead of system roots (implies -verify)")
 
 	// set custom usage text
 	flag.Usage = func() {
@@ -52,34 +313,377 @@ func main() {
 
 	flag.Parse()
 
-	// parse default port list into string slice
-	defaultPorts = strings.Split(ports, `,`)
+	if printVersion {
+		fmt.Println(versionString())
+		return
+	}
 
-	// channels
-	chanInput := make(chan string)
-	chanResult := make(chan *procResult)
+	// parse concurrency level
+	if concurrencyLevel == "auto" {
+		concurrency = autoConcurrency(100)
+	} else if n, err := strconv.Atoi(concurrencyLevel); err == nil && n > 0 {
+		concurrency = n
+	} else {
+		fmt.Fprintf(os.Stderr, "invalid -c: %q (must be a positive number or 'auto')\n", concurrencyLevel)
+		os.Exit(exitUsage)
+	}
+	if inputConcurrency < 1 {
+		fmt.Fprintf(os.Stderr, "invalid -ic: %d (must be a positive number)\n", inputConcurrency)
+		os.Exit(exitUsage)
+	}
 
-	// a common dialer
-	dialer := &net.Dialer{
-		Timeout: time.Duration(timeout) * time.Second,
+	// streaming JSON and certificate export are still JSON
+	if ndjsonOutput || certJSON {
+		jsonOutput = true
 	}
 
-	// create and start concurrent workers
-	var workersWG sync.WaitGroup
-	for i := 0; i < concurrency; i++ {
-		workersWG.Add(1)
-		go func() {
-			for addr := range chanInput {
-				result := &procResult{addr: addr}
-				result.names, result.err = grabCert(addr, dialer, onlyValidDomainNames)
-				chanResult <- result
+	// parse proxy URL
+	options.Proxy = nil
+	if proxyURL != "" {
+		var err error
+		if options.Proxy, err = url.Parse(proxyURL); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid proxy URL: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// parse local address to connect from
+	options.LocalAddr = nil
+	if source != "" {
+		var err error
+		if options.LocalAddr, err = parseSource(source); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -source: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// load roots to verify chains against
+	caRoots = nil
+	if caFile != "" {
+		verify = true
+		var err error
+		if caRoots, err = loadRoots(caFile); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load -cafile: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// load client certificate
+	options.Certificates = nil
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			fmt.Fprintln(os.Stderr, "-cert and -key must be set together")
+			os.Exit(exitUsage)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load client certificate: %s\n", err)
+			os.Exit(exitUsage)
+		}
+		options.Certificates = []tls.Certificate{cert}
+	}
+
+	// parse range of TLS versions
+	options.MinVersion = parseTLSVersion("min-version", minVersion)
+	options.MaxVersion = parseTLSVersion("max-version", maxVersion)
+
+	// parse application protocols to advertise
+	options.ALPN = nil
+	for _, proto := range strings.Split(alpn, ",") {
+		if proto = strings.TrimSpace(proto); proto != "" {
+			options.ALPN = append(options.ALPN, proto)
+		}
+	}
+
+	if options.CommonNameOnly && options.SANsOnly {
+		fmt.Fprintln(os.Stderr, "-cn-only and -sans-only are mutually exclusive")
+		os.Exit(exitUsage)
+	}
+
+	if options.STARTTLS != "" && options.AutoSTARTTLS {
+		fmt.Fprintln(os.Stderr, "-starttls and -auto-starttls are mutually exclusive")
+		os.Exit(exitUsage)
+	}
+
+	// parse pool of SNIs
+	sniPool = nil
+	if sniPoolList != "" {
+		if options.SNI != "" || options.NoSNI {
+			fmt.Fprintln(os.Stderr, "-sni-pool is mutually exclusive with -sni and -no-sni")
+			os.Exit(exitUsage)
+		}
+		for _, name := range strings.Split(sniPoolList, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if net.ParseIP(name) != nil {
+					fmt.Fprintf(os.Stderr, "invalid -sni-pool: %s is not a domain name\n", name)
+					os.Exit(exitUsage)
+				}
+				sniPool = append(sniPool, name)
 			}
-			workersWG.Done()
-		}()
+		}
+		if len(sniPool) == 0 {
+			fmt.Fprintln(os.Stderr, "invalid -sni-pool: no names")
+			os.Exit(exitUsage)
+		}
+	}
+
+	// validate browser to mimic, STARTTLS protocol, proxy and TLS version
+	if err := options.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	// parse parent domains to match names against
+	matchDomains = nil
+	for _, domain := range strings.Split(domains, ",") {
+		if domain = strings.TrimPrefix(normalizeName(strings.TrimSpace(domain)), "."); domain != "" {
+			matchDomains = append(matchDomains, domain)
+		}
+	}
+
+	// compile output template
+	outputTemplate = compileFormat(format)
+
+	// parse shape of CSV rows
+	switch csvPer {
+	case "name", "host":
+		csvPerHost = csvPer == "host"
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -csv-per: %q (must be 'name' or 'host')\n", csvPer)
+		os.Exit(exitUsage)
+	}
+
+	// compile regular expressions for names
+	grepNames = compilePattern("grep", grep)
+	grepOutNames = compilePattern("grep-v", grepOut)
+
+	// parse classes of errors to output
+	errorsOnly = nil
+	if errorClasses != "" {
+		errorsOnly = make(map[string]bool)
+		for _, class := range strings.Split(errorClasses, ",") {
+			if !isErrorClass(class) {
+				fmt.Fprintf(os.Stderr, "unknown class of errors: %s\n", class)
+				os.Exit(exitUsage)
+			}
+			errorsOnly[class] = true
+		}
+	}
+
+	// load table of issuer classes
+	issuerClasses = defaultIssuerClasses
+	if issuerClassesPath != "" {
+		var err error
+		if issuerClasses, err = loadIssuerClasses(issuerClassesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load -issuer-classes: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if issuerClassOnly != "" && !isIssuerClass(issuerClassOnly) {
+		fmt.Fprintf(os.Stderr, "unknown issuer class: %s (must be one of: %s)\n", issuerClassOnly, strings.Join(issuerClassLabels(issuerClasses), ", "))
+		os.Exit(exitUsage)
+	}
+
+	// open input files
+	var inputs []io.Reader
+	for _, path := range inputFiles {
+		if path == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open input file: %s\n", err)
+			os.Exit(exitUsage)
+		}
+		defer file.Close()
+		inputs = append(inputs, file)
+	}
+
+	// open output file
+	outFile = os.Stdout
+	if outPath != "" {
+		var err error
+		if outFile, err = os.Create(outPath); err != nil {
+			fmt.Fprintf(os.Stderr, "could not create output file: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// create directory for result files
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "could not create output directory: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// create directory for certificates
+	if dumpDir != "" {
+		if err := os.MkdirAll(dumpDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "could not create directory for certificates: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// STARTTLS protocol defines its own default port, unless ports are set explicitly
+	if port, ok := cero.STARTTLSDefaultPort(options.STARTTLS); ok && !isFlagSet("p") && portFile == "" {
+		ports = port
 	}
 
-	// close result channel when workers are done
+	// parse default port list (and ranges of ports) into string slice
+	var err error
+	if options.Ports, err = cero.ParsePorts(ports); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -p: %s\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// ports of -port-file replace default port list, or are added to the one set with -p
+	if portFile != "" {
+		filePorts, err := loadPorts(portFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -port-file: %s\n", err)
+			os.Exit(exitUsage)
+		}
+		if !isFlagSet("p") {
+			options.Ports = nil
+		}
+		options.Ports = unionPorts(options.Ports, filePorts)
+	}
+
+	// custom DNS servers (or DoH endpoint) resolve names both to dial and to feed as targets (with -resolve-all and -recurse)
+	options.Resolver = nil
+	switch {
+	case resolvers != "" && dohURL != "":
+		fmt.Fprintln(os.Stderr, "-resolver and -doh are mutually exclusive")
+		os.Exit(exitUsage)
+	case dohURL != "":
+		if options.Resolver, err = cero.NewDoHResolver(dohURL, time.Duration(timeout)*time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -doh: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	case resolvers != "":
+		var servers []string
+		for _, server := range strings.Split(resolvers, ",") {
+			if server = strings.TrimSpace(server); server != "" {
+				servers = append(servers, server)
+			}
+		}
+		if options.Resolver, err = cero.NewResolver(servers); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -resolver: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if options.Resolver != nil {
+		lookupIPAddr = options.Resolver.LookupIPAddr
+		lookupAddr = options.Resolver.LookupAddr
+	}
+
+	// every name is resolved once per run, both to dial and to feed as targets
+	dnsLookups = newDNSCache(lookupIPAddr)
+
+	// every scanned IP is looked up once per run
+	ptrLookups = nil
+	if reverseLookup {
+		ptrLookups = newPTRCache(lookupAddr)
+	}
+	options.LookupIPAddr = dnsLookups.LookupIPAddr
+
+	options.Timeout = time.Duration(timeout) * time.Second
+	options.HandshakeTimeout = time.Duration(handshakeTimeout) * time.Second
+	options.Retries = retries
+	// resets may come from IDS or firewall, deliberately dropping the scan: retry them only on demand
+	options.RetryResets = isFlagSet("r") || isFlagSet("retries")
+
+	// rate of connections is shared by all workers
+	options.Limiter = nil
+	switch {
+	case connRate < 0:
+		fmt.Fprintf(os.Stderr, "invalid -rate: %v (must not be negative)\n", connRate)
+		os.Exit(exitUsage)
+	case connRate > 0:
+		options.Limiter = rate.NewLimiter(rate.Limit(connRate), 1)
+	}
+
+	// start with no targets in flight and no names visited
+	pending = sync.WaitGroup{}
+	visited.names = make(map[string]struct{})
+
+	// interrupt stops feeding new targets and cancels connections in flight
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// repeated interrupt kills the process
+		<-sigCtx.Done()
+		stop()
+	}()
+
+	// exceeded deadline stops the run the same way.
+	// context is cancelled by timer (not by its own deadline), so that connections in flight fail as cancelled, not timed out
+	ctx, cancel := context.WithCancel(sigCtx)
+	defer cancel()
+	var deadlineTimer *time.Timer
+	if runDeadline > 0 {
+		deadlineTimer = time.AfterFunc(runDeadline, cancel)
+	}
+
+	// load ASN database (download is interrupted by the run's cancellation)
+	asnDatabase = nil
+	if asnLookup != "" {
+		var err error
+		if asnDatabase, err = loadASNDB(ctx, asnLookup); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load ASN database: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	asnPrefixes = asnDatabase
+	if asnSource != "" {
+		var err error
+		if asnPrefixes, err = loadASNDB(ctx, asnSource); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load -asn-source: %s\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// channels
+	chanInput := make(chan *procTarget)
+	chanResult := make(chan *procResult)
+
+	// run is measured from the start of workers
+	stats := newRunStats()
+	knownTargets, enqueuedTargets, doneTargets = 0, 0, 0
+
+	// dispatch targets to workers: every target is processed in its own goroutine, once slot of connection is taken.
+	// targets are not taken from input until there is a free slot, so that feeding blocks, while all slots are busy
+	slots := newConnSlots(concurrency)
+	var workersWG sync.WaitGroup
 	go func() {
+		for target := range chanInput {
+			// listing: target is output as is (with its SNI, given with input)
+			if listOnly {
+				addr := target.addr
+				if target.sni != "" {
+					addr += "@" + target.sni
+				}
+				chanResult <- &procResult{id: target.id, addr: addr, hostPorts: target.hostPorts, depth: target.depth, ts: time.Now()}
+				continue
+			}
+			if !slots.acquire(ctx) {
+				chanResult <- cancelledResult(ctx, target)
+				continue
+			}
+			workersWG.Add(1)
+			go func(target *procTarget) {
+				defer workersWG.Done()
+				result := processHostPorts(ctx, slots, target)
+				if !errors.Is(result.err, context.Canceled) {
+					atomic.AddUint64(&doneTargets, 1)
+				}
+				chanResult <- result
+			}(target)
+		}
+
+		// close result channel when workers are done
 		workersWG.Wait()
 		close(chanResult)
 	}()
@@ -88,116 +692,928 @@ func main() {
 	var outputWG sync.WaitGroup
 	outputWG.Add(1)
 	go func() {
-		for result := range chanResult {
-			// in verbose mode, print all errors and results, with corresponding input values
-			if verbose {
-				if result.err != nil {
-					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, result.err)
-				} else {
-					fmt.Fprintf(os.Stdout, "%s -- %s\n", result.addr, result.names)
-				}
-			} else {
+		// resource records held until the end of the run, grouped by names (in resource records mode)
+		records := newRRGroups()
+
+		// normalized names already printed (in unique names mode)
+		seenNames := make(map[string]struct{})
+
+		// names held until the end of the run (in sorted mode)
+		var sortedNames []string
+
+		// fingerprints of certificates already printed (in unique certificates mode)
+		seenCerts := make(map[string]struct{})
+
+		// results buffered until all ports of the host are processed (in host grouping mode)
+		groups := make(hostGroups)
+
+		// results are buffered, to keep up with massive scans (flushed, once results are drained)
+		out := bufio.NewWriterSize(outFile, outputBufferSize)
+		jsonEncoder := json.NewEncoder(out)
+		csvWriter := csv.NewWriter(out)
+		if csvOutput && outputTemplate == nil {
+			csvWriter.Write(csvHeader(csvPerHost))
+		}
+
+		// errors go to output file too, if it's set in verbose mode
+		var errOut io.Writer = os.Stderr
+		if outFile != os.Stdout {
+			errOut = out
+		}
+
+		// outputs single result
+		emit := func(result *procResult) {
+			switch {
+			case outputTemplate != nil:
+				// template: every result (including errors), shaped by user
+				if err := writeTemplate(out, outputTemplate, result); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, err)
+				}
+			case csvOutput:
+				// CSV: every result (including errors) as rows
+				if err := writeCSV(csvWriter, result, csvPerHost); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, err)
+				}
+			case jsonOutput:
+				// JSON: every result (including errors) as single record
+				if err := jsonEncoder.Encode(newJSONResult(result)); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, err)
+				}
+				if ndjsonOutput {
+					out.Flush()
+				}
+			case result.err != nil:
+				// in verbose mode, print all errors with corresponding input values.
+				// when output is limited to errors, they are the result. otherwise, they are shown on demand
+				if verbose {
+					fmt.Fprintln(errOut, verboseErrorLine(result))
+				} else if errorsOnly != nil {
+					fmt.Fprintln(out, verboseErrorLine(result))
+				} else if showErrors {
+					fmt.Fprintln(os.Stderr, verboseErrorLine(result))
+				}
+			case rrOutput:
+				// resource records: every name-to-IP mapping only once, grouped by names at the end of the run
+				records.add(resourceRecords(result))
+			case verbose:
+				// verbose: print results with corresponding input values
+				fmt.Fprintln(out, verboseLine(result))
+			default:
 				// non-verbose: just print scraped names, one at line
 				for _, name := range result.names {
-					fmt.Fprintln(os.Stdout, name)
+					if uniqueNames {
+						key := normalizeName(name)
+						if _, seen := seenNames[key]; seen {
+							continue
+						}
+						seenNames[key] = struct{}{}
+					}
+					if showAddr {
+						name = fmt.Sprintf("%s [%s]", name, result.remote)
+					}
+					if sortNames {
+						sortedNames = append(sortedNames, name)
+					} else {
+						fmt.Fprintln(out, name)
+					}
+				}
+			}
+		}
+
+		// outputs results of all ports of the same host
+		emitGroup := func(results []*procResult) {
+			switch {
+			case outputTemplate != nil || csvOutput:
+				// template and CSV rows are applied to every port separately
+				for _, result := range results {
+					emit(result)
+				}
+			case jsonOutput:
+				// JSON: all ports of the host in single record
+				if err := jsonEncoder.Encode(newJSONHostGroup(results)); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", results[0].addr, err)
+				}
+				if ndjsonOutput {
+					out.Flush()
+				}
+			case verbose && !rrOutput:
+				// verbose: print all ports of the host in single line
+				fmt.Fprintln(out, hostGroupLine(results))
+			default:
+				for _, result := range results {
+					emit(result)
 				}
 			}
 		}
+
+		// processes single result
+		handle := func(result *procResult) {
+			// listing: targets are output regardless of output mode (errors of input are output as usual)
+			if listOnly && result.err == nil {
+				fmt.Fprintln(out, result.addr)
+				return
+			}
+
+			// dry run: estimates of blocks are output the same way
+			if dryRun && result.err == nil {
+				fmt.Fprintf(out, "%s -- %s\n", result.addr, result.estimate)
+				return
+			}
+
+			stats.add(result)
+
+			// feed newly discovered names back as targets
+			if recurse && result.err == nil && result.depth < maxDepth {
+				recurseNames(ctx, result, chanInput)
+			}
+
+			// skip results that do not pass filters
+			skip := isFiltered(result)
+
+			// skip certificates already printed
+			if uniqueCerts && result.err == nil && !skip {
+				_, skip = seenCerts[result.sha256]
+				seenCerts[result.sha256] = struct{}{}
+			}
+
+			// write every result into its own file
+			if outDir != "" && !skip {
+				if err := writeResultFile(outDir, result); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, err)
+				}
+			}
+
+			// write certificates as PEM, every distinct one only once
+			if dumpDir != "" && result.err == nil && !skip {
+				if err := dumpCertificates(dumpDir, result); err != nil {
+					fmt.Fprintf(os.Stderr, "%s -- %s\n", result.addr, err)
+				}
+			}
+
+			// in host grouping mode, skipped results are still counted as processed ports
+			if groupHost {
+				if results, complete := groups.add(result, !skip); complete && len(results) > 0 {
+					emitGroup(results)
+				}
+				return
+			}
+
+			if !skip {
+				emit(result)
+			}
+		}
+
+		for result := range chanResult {
+			handle(result)
+			pending.Done()
+		}
+
+		// hosts, that did not get all of their ports processed (e.g. cut by -max limit)
+		for _, group := range groups {
+			if len(group.results) > 0 {
+				emitGroup(group.results)
+			}
+		}
+		if sortNames {
+			sort.Strings(sortedNames)
+			for _, name := range sortedNames {
+				fmt.Fprintln(out, name)
+			}
+		}
+		for _, record := range records.lines(sortNames) {
+			fmt.Fprintln(out, record)
+		}
+		csvWriter.Flush()
+		if err := out.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write output: %s\n", err)
+		}
+		if printStats {
+			fmt.Fprintln(os.Stderr, stats)
+		}
 		outputWG.Done()
 	}()
 
-	// consume output to start things moving
-	if len(flag.Args()) > 0 {
-		for _, addr := range flag.Args() {
-			processInputItem(addr, chanInput, chanResult)
+	// read input in dedicated goroutine, so that reading overlaps with processing.
+	// it might outlive the run, if it's stopped early while reading blocks
+	args := flag.Args()
+	chanItems := make(chan *inputItem)
+	go func() {
+		defer close(chanItems)
+		var count uint64
+		for _, addr := range args {
+			if !sendItem(ctx, chanItems, &count, addr) {
+				return
+			}
 		}
-	} else {
-		// every line of stdin is considered as a input
-		sc := bufio.NewScanner(os.Stdin)
-		for sc.Scan() {
-			addr := strings.TrimSpace(sc.Text())
-			processInputItem(addr, chanInput, chanResult)
+
+		// stdin is read, unless targets are given otherwise
+		if len(args) == 0 && len(inputs) == 0 {
+			inputs = []io.Reader{os.Stdin}
+		}
+		for _, input := range inputs {
+			if !sendLines(ctx, chanItems, &count, input) {
+				return
+			}
 		}
+	}()
+
+	// report progress while processing
+	progressDone := make(chan struct{})
+	var progressWG sync.WaitGroup
+	if showProgress {
+		progressWG.Add(1)
+		go func() {
+			reportProgress(stats.start, progressDone)
+			progressWG.Done()
+		}()
 	}
 
-	// close input channel when input fully consumed
+	// consume input to start things moving
+	fedTargets, skippedTargets, duplicateTargets = 0, 0, 0
+	fedSet = nil
+	if dedupeTargets {
+		fedSet = newTargetSet()
+	}
+	processInput(ctx, chanItems, chanInput, chanResult)
+
+	if verbose && skippedTargets > 0 {
+		fmt.Fprintf(os.Stderr, "limit of %d targets reached, %s targets skipped\n", maxTargets, countString(skippedTargets))
+	}
+	if verbose && duplicateTargets > 0 {
+		fmt.Fprintf(os.Stderr, "%s duplicate targets skipped\n", countString(duplicateTargets))
+	}
+
+	// close input channel when input fully consumed, including targets fed recursively
+	pending.Wait()
 	close(chanInput)
 
 	// wait for processing to finish
 	outputWG.Wait()
+	close(progressDone)
+	progressWG.Wait()
+
+	// timer that already fired can not be stopped
+	incomplete := deadlineTimer != nil && !deadlineTimer.Stop()
+	if incomplete && verbose {
+		fmt.Fprintf(os.Stderr, "deadline of %s exceeded, %s targets left unprocessed\n", runDeadline, countString(satSub(totalTargets(), atomic.LoadUint64(&doneTargets))))
+	}
+
+	// make sure results are on disk
+	if outFile != os.Stdout {
+		if err := outFile.Sync(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write output file: %s\n", err)
+		}
+		outFile.Close()
+	}
+
+	if incomplete {
+		exit(exitIncomplete)
+	} else if exitStatus && stats.successful == 0 {
+		exit(exitFailed)
+	}
+}
+
+// compiles regular expression, set with flag (nil if not set). exits on invalid expression
+func compilePattern(name, pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -%s pattern: %s\n", name, err)
+		os.Exit(exitUsage)
+	}
+	return re
+}
+
+// parses TLS version, set with flag (zero if not set). exits on unsupported version
+func parseTLSVersion(name, value string) uint16 {
+	if value == "" {
+		return 0
+	}
+	version, err := cero.ParseTLSVersion(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -%s: %s\n", name, err)
+		os.Exit(exitUsage)
+	}
+	return version
+}
+
+// reports whether class is one of classes of errors
+func isErrorClass(class string) bool {
+	for _, known := range cero.ErrorClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+// flag that can be repeated, collecting all of its values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// reports whether flag was explicitly set in commandline arguments
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+// sends input item to channel, numbered after count of items sent before, unless ctx is cancelled first.
+// reports whether item was sent
+func sendItem(ctx context.Context, items chan *inputItem, count *uint64, text string) bool {
+	select {
+	case items <- &inputItem{id: *count + 1, text: text}:
+		*count++
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sends every line of input as input item, without comments. reports whether input was fully sent
+func sendLines(ctx context.Context, items chan *inputItem, count *uint64, input io.Reader) bool {
+	sc := bufio.NewScanner(input)
+	for sc.Scan() {
+		line := stripComment(sc.Text())
+		if line == "" {
+			continue
+		}
+		if !sendItem(ctx, items, count, line) {
+			return false
+		}
+	}
+	if err := sc.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not read input: %s\n", err)
+	}
+	return true
+}
+
+// parses local IP to connect from (with zone, if any), and checks that it's assigned to this host
+func parseSource(s string) (*net.TCPAddr, error) {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	addr := &net.TCPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+
+	// binding fails, unless IP is local
+	l, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.Close()
+	return addr, nil
+}
+
+// loads ports from file: list of ports (or ranges of ports) at every line, as with -p.
+// empty lines and comments are skipped
+func loadPorts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ports []string
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := stripComment(sc.Text())
+		if text == "" {
+			continue
+		}
+		linePorts, err := cero.ParsePorts(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ports = append(ports, linePorts...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%s: no ports", path)
+	}
+	return ports, nil
+}
+
+// returns ports of both lists, in order of their first appearance
+func unionPorts(a, b []string) []string {
+	var union []string
+	seen := make(map[string]struct{}, len(a)+len(b))
+	for _, port := range append(append([]string(nil), a...), b...) {
+		if _, ok := seen[port]; !ok {
+			seen[port] = struct{}{}
+			union = append(union, port)
+		}
+	}
+	return union
+}
+
+// strips comment from input line: the whole line starting with #, or trailing one, preceded by whitespace
+func stripComment(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	for i := 1; i < len(line); i++ {
+		if line[i] == '#' && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
+
+// processes input items concurrently (with inputConcurrency goroutines)
+// returns when all items are consumed and processed
+func processInput(ctx context.Context, items chan *inputItem, chanInput chan *procTarget, chanResult chan *procResult) {
+	var wg sync.WaitGroup
+	for i := 0; i < inputConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// reading of input might block (on stdin), so cancellation is not waited from it
+				select {
+				case item, ok := <-items:
+					if !ok {
+						return
+					}
+					processInputItem(ctx, item.text, item.id, chanInput, chanResult)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
 }
 
 // process input item
 // if orrors occur during parsing, they are pushed straight to result channel
-func processInputItem(input string, chanInput chan string, chanResult chan *procResult) {
+func processInputItem(ctx context.Context, input string, id uint64, chanInput chan *procTarget, chanResult chan *procResult) {
 	// initial inputs are skipped
 	input = strings.TrimSpace(input)
 	if input == "" {
 		return
 	}
 
-	// split input to host and port (if specified)
-	host, port := splitHostPort(input)
+	// split off SNI to send to targets of input item
+	target, sni, err := cero.SplitServerName(input)
+	if err != nil {
+		sendError(chanResult, input, id, err)
+		return
+	}
 
-	// get ports list to use
-	var ports []string
-	if port == "" {
-		// use ports from default list if not specified explicitly
-		ports = defaultPorts
-	} else {
-		ports = []string{port}
+	// split input to host and ports to use
+	host, ports, err := cero.ParseTarget(target, &options)
+	if err != nil {
+		sendError(chanResult, input, id, err)
+		return
 	}
 
-	// CIDR?
-	if isCIDR(host) {
-		// expand CIDR
-		ips, err := expandCIDR(host)
-		if err != nil {
-			chanResult <- &procResult{addr: input, err: err}
+	// autonomous system: every prefix it announces is expanded as CIDR
+	if asn, ok := parseASN(host); ok {
+		if asnPrefixes == nil {
+			sendError(chanResult, input, id, errors.New("ASN database is required to expand AS, set -asn-source or -asn-lookup"))
 			return
 		}
+		prefixes := asnPrefixes.prefixes(asn)
+		if len(prefixes) == 0 {
+			sendError(chanResult, input, id, fmt.Errorf("AS%d announces no prefixes", asn))
+			return
+		}
+		for _, prefix := range prefixes {
+			if ctx.Err() != nil {
+				return
+			}
+			feedIPBlock(ctx, prefix, prefix, sni, id, ports, chanInput, chanResult)
+		}
+		return
+	}
+
+	// CIDR or range of IPs?
+	if cero.IsCIDR(host) || cero.IsIPRange(host) {
+		feedIPBlock(ctx, input, host, sni, id, ports, chanInput, chanResult)
+	} else if !dryRun {
+		// hosts to dial, and SNI to send to them
+		hosts := []string{host}
+		var serverName string
 
-		// feed IPs from CIDR to input channel
-		for ip := range ips {
-			for _, port := range ports {
-				chanInput <- net.JoinHostPort(ip, port)
+		// names given as input are not fed again
+		if recurse && net.ParseIP(host) == nil {
+			visitName(host)
+		}
+
+		// dial every IP of the domain name, sending domain name itself as SNI
+		if resolveAll && net.ParseIP(host) == nil {
+			ips, err := resolveIPs(ctx, host)
+			if err != nil {
+				sendError(chanResult, input, id, err)
+				return
 			}
+			hosts, serverName = ips, host
 		}
-	} else {
-		// feed atomic host to input channel
-		for _, port := range ports {
-			chanInput <- net.JoinHostPort(host, port)
+
+		feedHosts(ctx, hosts, serverName, sni, id, ports, 0, chanInput)
+	}
+}
+
+// expands CIDR or range of IPs (block of input item), and feeds every port of every IP to input channel.
+// sni is sent to every target, if not empty
+func feedIPBlock(ctx context.Context, input, block, sni string, id uint64, ports []string, chanInput chan *procTarget, chanResult chan *procResult) {
+	// expansion is stopped, when feeding stops early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// expand CIDR or range
+	ips, size, err := expandIPs(ctx, block)
+	if err != nil {
+		sendError(chanResult, input, id, err)
+		return
+	}
+	targets := satMul(size, uint64(targetsPerHost(ports)))
+
+	// dry run: only estimate (output as result of the block)
+	if dryRun {
+		pending.Add(1)
+		chanResult <- &procResult{id: id, addr: block, ts: time.Now(), estimate: fmt.Sprintf("%s IPs, %s targets", countString(size), countString(targets))}
+		return
+	}
+
+	// warn before expanding enormous number of IPs, ask for confirmation if possible
+	if size > hugeCIDRSize {
+		if !confirmExpansion(block, size) {
+			sendError(chanResult, input, id, errors.New("expansion not confirmed"))
+			return
 		}
 	}
+	satAddCounter(&knownTargets, targets)
+
+	// feed IPs to input channel
+	var fed uint64
+	for ip := range ips {
+		for _, target := range hostTargets(ip, "", sni, id, ports, 0) {
+			if isDuplicate(target) {
+				fed++
+				continue
+			}
+			if !reserveTarget() {
+				skipTargets(satSub(targets, fed))
+				return
+			}
+			if !sendTarget(ctx, chanInput, target) {
+				return
+			}
+			fed++
+		}
+	}
+}
+
+// feeds every port of every host to input channel
+func feedHosts(ctx context.Context, hosts []string, serverName, sni string, id uint64, ports []string, depth int, chanInput chan *procTarget) {
+	perHost := targetsPerHost(ports)
+	satAddCounter(&knownTargets, uint64(len(hosts)*perHost))
+	for h, host := range hosts {
+		for i, target := range hostTargets(host, serverName, sni, id, ports, depth) {
+			if isDuplicate(target) {
+				continue
+			}
+			if !reserveTarget() {
+				skipTargets(uint64((len(hosts)-h)*perHost - i))
+				return
+			}
+			if !sendTarget(ctx, chanInput, target) {
+				return
+			}
+		}
+	}
+}
+
+// returns atomic targets of every port of host. with -first-port, it's a single target,
+// that tries ports in order
+func hostTargets(host, serverName, sni string, id uint64, ports []string, depth int) []*procTarget {
+	if firstPort && len(ports) > 1 {
+		return []*procTarget{{id: id, addr: net.JoinHostPort(host, ports[0]), serverName: serverName, sni: sni, hostPorts: 1, nextPorts: ports[1:], depth: depth}}
+	}
+	targets := make([]*procTarget, len(ports))
+	for i, port := range ports {
+		targets[i] = &procTarget{id: id, addr: net.JoinHostPort(host, port), serverName: serverName, sni: sni, hostPorts: len(ports), depth: depth}
+	}
+	return targets
+}
+
+// returns number of atomic targets of every host with ports (see hostTargets)
+func targetsPerHost(ports []string) int {
+	if firstPort && len(ports) > 1 {
+		return 1
+	}
+	return len(ports)
+}
+
+// feeds valid domain names of the result, not visited yet, as targets of the next depth.
+// names are resolved and fed in background, so that output is never blocked by input
+func recurseNames(ctx context.Context, result *procResult, chanInput chan *procTarget) {
+	// only names, never IPs or wildcards
+	var names []string
+	for _, name := range result.names {
+		if cero.IsDomainName(name) && visitName(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		for _, name := range names {
+			ips, err := resolveIPs(ctx, name)
+			if err != nil {
+				continue
+			}
+			feedHosts(ctx, ips, strings.TrimSuffix(name, "."), "", result.id, options.Ports, result.depth+1, chanInput)
+		}
+	}()
 }
 
-/* connects to addr and grabs certificate information.
-returns slice of domain names from grabbed certificate */
-func grabCert(addr string, dialer *net.Dialer, onlyValidDomainNames bool) ([]string, error) {
-	// dial
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+// marks domain name as visited. reports whether it was not visited before
+func visitName(name string) bool {
+	key := normalizeName(name)
+
+	visited.Lock()
+	defer visited.Unlock()
+	if _, seen := visited.names[key]; seen {
+		return false
+	}
+	visited.names[key] = struct{}{}
+	return true
+}
+
+// resolves domain name to all of its distinct IPs (both IPv4 and IPv6)
+func resolveIPs(ctx context.Context, host string) ([]string, error) {
+	addrs, err := dnsLookups.LookupIPAddr(ctx, host)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
-	// get first certificate in chain
-	cert := conn.ConnectionState().PeerCertificates[0]
+	seen := make(map[string]struct{}, len(addrs))
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if _, ok := seen[ip]; !ok {
+			seen[ip] = struct{}{}
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// expands CIDR or range of IPs (in pseudo-random order, if requested). returns IPs and their number
+func expandIPs(ctx context.Context, block string) (chan string, uint64, error) {
+	if cero.IsCIDR(block) {
+		var ips chan string
+		var err error
+		switch {
+		case shuffle && skipEdges:
+			ips, err = cero.ExpandCIDRHostsShuffled(ctx, block, rand.Uint64())
+		case shuffle:
+			ips, err = cero.ExpandCIDRShuffled(ctx, block, rand.Uint64())
+		case skipEdges:
+			ips, err = cero.ExpandCIDRHosts(ctx, block)
+		default:
+			ips, err = cero.ExpandCIDR(ctx, block)
+		}
+		return ips, cidrSize(block, skipEdges), err
+	}
+
+	size, err := cero.IPRangeSize(block)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ips chan string
+	if shuffle {
+		ips, err = cero.ExpandIPRangeShuffled(ctx, block, rand.Uint64())
+	} else {
+		ips, err = cero.ExpandIPRange(ctx, block)
+	}
+	return ips, size, err
+}
+
+// CIDRs (and ranges) larger than this are expanded only after warning
+const hugeCIDRSize = 1 << 20
+
+// serializes confirmations of concurrent input goroutines
+var confirmMu sync.Mutex
+
+// warns that CIDR or range expands to enormous number of IPs.
+// if targets are given in arguments and stdin is a terminal, asks user for confirmation (unless -yes is set).
+// reports whether expansion may proceed
+func confirmExpansion(block string, size uint64) bool {
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "warning: %s expands to %s IPs\n", block, countString(size))
+	if assumeYes || flag.NArg() == 0 {
+		return true
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "proceed? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// formats number of IPs or targets (saturated values are at least 2^64)
+func countString(n uint64) string {
+	if n == math.MaxUint64 {
+		return "at least 2^64"
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// reserves slot for one more target under -max limit. reports false if limit is already reached
+func reserveTarget() bool {
+	return maxTargets <= 0 || atomic.AddUint64(&fedTargets, 1) <= uint64(maxTargets)
+}
+
+// reports whether target was already fed (with -dedupe-targets), counting it as duplicate
+func isDuplicate(target *procTarget) bool {
+	if fedSet == nil || fedSet.add(target) {
+		return false
+	}
+	atomic.AddUint64(&duplicateTargets, 1)
+	return true
+}
+
+// counts n targets skipped because of -max limit
+func skipTargets(n uint64) {
+	satAddCounter(&skippedTargets, n)
+}
+
+// returns number of IPs in CIDR (saturated at math.MaxUint64), optionally without network and broadcast addresses
+func cidrSize(CIDR string, skipEdges bool) uint64 {
+	_, ipnet, err := net.ParseCIDR(CIDR)
+	if err != nil {
+		return 0
+	}
+	ones, size := ipnet.Mask.Size()
+	if size-ones >= 64 {
+		return math.MaxUint64
+	}
+	if skipEdges && size == 32 && ones <= 30 {
+		return 1<<(size-ones) - 2
+	}
+	return 1 << (size - ones)
+}
+
+// saturating arithmetic on target counts
+func satAdd(a, b uint64) uint64 {
+	if sum, carry := bits.Add64(a, b, 0); carry == 0 {
+		return sum
+	}
+	return math.MaxUint64
+}
+
+func satMul(a, b uint64) uint64 {
+	if hi, lo := bits.Mul64(a, b); hi == 0 {
+		return lo
+	}
+	return math.MaxUint64
+}
+
+func satSub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// sends target to input channel, unless ctx is cancelled first. reports whether target was sent
+func sendTarget(ctx context.Context, chanInput chan *procTarget, target *procTarget) bool {
+	pending.Add(1)
+	select {
+	case chanInput <- target:
+		atomic.AddUint64(&enqueuedTargets, 1)
+		return true
+	case <-ctx.Done():
+		pending.Done()
+		return false
+	}
+}
+
+// sends error of input item straight to result channel
+func sendError(chanResult chan *procResult, input string, id uint64, err error) {
+	pending.Add(1)
+	chanResult <- &procResult{id: id, addr: input, ts: time.Now(), err: err}
+}
+
+// processes single atomic target: grabs certificate chain and extracts requested information from it
+func processTarget(ctx context.Context, target *procTarget) *procResult {
+	addr := target.addr
+	result := &procResult{id: target.id, addr: addr, hostPorts: target.hostPorts, depth: target.depth}
+
+	// annotate scanned IP with its autonomous system and names of its PTR records
+	host, _, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); ip != nil {
+		if asnDatabase != nil {
+			if rng, ok := asnDatabase.lookup(ip); ok {
+				result.asn, result.asOrg = rng.asn, rng.org
+			}
+		}
+		if ptrLookups != nil {
+			result.ptr = ptrLookups.LookupAddr(ctx, host)
+		}
+	}
+
+	// SNI given with input overrides the global one (or the pool). resolved IP is dialed on behalf of its domain name
+	// (unless SNI is forced or disabled)
+	opts := options
+	switch {
+	case target.sni != "":
+		opts.SNI, opts.NoSNI = target.sni, false
+	case len(sniPool) > 0:
+		opts.SNI = sniPool[rand.Intn(len(sniPool))]
+		result.sni = opts.SNI
+	case target.serverName != "" && opts.SNI == "" && !opts.NoSNI:
+		opts.SNI = target.serverName
+	}
 
-	// get CommonName and all SANs into a slice
-	names := make([]string, 0, len(cert.DNSNames)+1)
-	if onlyValidDomainNames && isDomainName(cert.Subject.CommonName) || !onlyValidDomainNames {
-		names = append(names, cert.Subject.CommonName)
+	grabbed, err := grabCert(ctx, addr, &opts)
+	result.ts = time.Now()
+	if err != nil {
+		result.err = err
+		return result
 	}
 
-	// append all SANs, excluding one that is equal to CN (if any)
-	for _, name := range cert.DNSNames {
-		if name != cert.Subject.CommonName {
-			if onlyValidDomainNames && isDomainName(name) || !onlyValidDomainNames {
-				names = append(names, name)
+	result.names = filterNames(grabbed.Names)
+	result.notBefore, result.notAfter = grabbed.NotBefore, grabbed.NotAfter
+	result.issuerCN, result.issuerOrg = grabbed.IssuerCN, grabbed.IssuerOrg
+	result.sha256 = grabbed.SHA256
+	result.version, result.cipher = grabbed.Version, grabbed.CipherSuite
+	result.alpn = grabbed.ALPN
+	result.remote = grabbed.RemoteAddr
+	result.hostname, result.hostMatch = grabbed.Hostname, grabbed.HostnameMatch
+	result.pubKeyAlg, result.pubKeyBits = grabbed.PublicKeyAlgorithm, grabbed.PublicKeyBits
+	result.selfSigned = grabbed.SelfSigned
+	result.issuerClass = classifyIssuer(issuerClasses, result)
+
+	if certJSON {
+		result.cert = newJSONCert(grabbed.Chain[0])
+	}
+
+	if dumpDir != "" {
+		result.certs = [][]byte{grabbed.Chain[0].Raw}
+		if options.FullChain {
+			result.certs = result.certs[:0]
+			for _, cert := range grabbed.Chain {
+				result.certs = append(result.certs, cert.Raw)
 			}
 		}
 	}
 
-	return names, nil
+	for i, cert := range grabbed.ChainNames {
+		result.chain = append(result.chain, chainCert{
+			subject: dnString(grabbed.Chain[i].Subject.CommonName, grabbed.Chain[i].Subject.Organization),
+			issuer:  dnString(grabbed.Chain[i].Issuer.CommonName, grabbed.Chain[i].Issuer.Organization),
+			names:   filterNames(cert),
+		})
+	}
+
+	// chain is verified for the name sent as SNI (the one of input, of the pool, or the global one)
+	if verify {
+		if opts.SNI != "" {
+			host = opts.SNI
+		} else if target.serverName != "" {
+			host = target.serverName
+		}
+		result.verifyErr = verifyChain(grabbed.Chain, host, caRoots)
+	}
+	return result
+}
+
+// returns names of supported STARTTLS protocols with their default ports, for usage text
+func starttlsUsage() string {
+	protocols := cero.STARTTLSProtocols()
+	for i, name := range protocols {
+		port, _ := cero.STARTTLSDefaultPort(name)
+		protocols[i] = fmt.Sprintf("%s (default port %s)", name, port)
+	}
+	return strings.Join(protocols, ", ")
 }
@@ -1,19 +1,45 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/glebarez/cero/pkg/cero"
+	"github.com/quic-go/quic-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,20 +56,2160 @@ func Test_main_addr(t *testing.T) {
 	// grab URL of test TLS server
 	tsURL, _ := url.Parse(ts.URL)
 
+	// names expected to be grabbed from test server certificate
+	expected := strings.Join(ts.Certificate().DNSNames, "\n")
+
 	// test atomic addr
 	os.Args = []string{"cero-test", tsURL.Host}
 	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
 
 	output := captureOutput(main)
-	assert.Equal(t, "example.com", strings.TrimSpace(output))
+	assert.Equal(t, expected, strings.TrimSpace(output))
 
 	// test CIDR
-	host, port := splitHostPort(tsURL.Host)
+	host, port := cero.SplitHostPort(tsURL.Host)
 	os.Args = []string{"cero-test", fmt.Sprintf("%s/30:%s", host, port)}
 	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
 
 	output = captureOutput(main)
-	assert.Equal(t, "example.com", strings.TrimSpace(output))
+	assert.Equal(t, expected, strings.TrimSpace(output))
+}
+
+func Test_main_verify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// test server certificate is self-signed, and is not any of system roots
+	os.Args = []string{"cero-test", "-v", "-verify", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "verify: self-signed")
+
+	// it's valid, when trusted explicitly
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"cero-test", "-v", "-cafile", caFile, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "verify: valid")
+
+	// certificate issued by unknown CA
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Example CA"},
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	leaf := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	leaf.Certificate[0], err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, leaf.PrivateKey.(*ecdsa.PrivateKey).Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued := httptest.NewUnstartedServer(http.NotFoundHandler())
+	issued.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+	issued.StartTLS()
+	defer issued.Close()
+
+	issuedURL, _ := url.Parse(issued.URL)
+	os.Args = []string{"cero-test", "-v", "-verify", issuedURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "verify: untrusted root")
+}
+
+func Test_main_verify_sni(t *testing.T) {
+	// certificate is valid only for one name (bare IP of server is not checked)
+	ts := newTestServer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "www.example.com"}, DNSNames: []string{"www.example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.TLS.Certificates[0].Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-sni", "www.example.com"}, "verify: valid"},
+		{[]string{"-sni", "other.example.com"}, "verify: hostname mismatch"},
+	} {
+		os.Args = append(append([]string{"cero-test", "-v", "-verify", "-cafile", caFile}, tt.args...), tsURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Contains(t, output, tt.expected, tt.args)
+	}
+}
+
+func Test_main_mimic(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	for _, browser := range cero.MimicBrowsers() {
+		os.Args = []string{"cero-test", "-mimic", browser, tsURL.Host}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, strings.Join(ts.Certificate().DNSNames, "\n"), strings.TrimSpace(output), browser)
+	}
+}
+
+func Test_main_asnLookup(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	path := filepath.Join(t.TempDir(), "asn.tsv")
+	if err := os.WriteFile(path, []byte(testASNData), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Args = []string{"cero-test", "-v", "-asn-lookup", path, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "-- AS64512 TEST-ORG")
+}
+
+func Test_main_asnInput(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// database is downloaded
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "127.0.0.1\t127.0.0.1\t64512\tZZ\tTEST-ORG\n10.0.0.0\t10.0.0.3\t64513\tZZ\tTEST-ORG\n")
+	}))
+	defer db.Close()
+
+	os.Args = []string{"cero-test", "-dry-run", "-asn-source", db.URL, "AS64512", "AS64513"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "10.0.0.0/30 -- 4 IPs, 4 targets")
+	assert.Contains(t, output, "127.0.0.1/32 -- 1 IPs, 1 targets")
+
+	// every IP of AS is grabbed
+	os.Args = []string{"cero-test", "-v", "-asn-source", db.URL, "AS64512:" + tsURL.Port(), "AS1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, tsURL.Host+" -- [")
+	assert.Contains(t, output, "AS1 -- other: AS1 announces no prefixes")
+
+	// AS can not be expanded without database
+	os.Args = []string{"cero-test", "-v", "AS64512"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "AS64512 -- other: ASN database is required")
+}
+
+func Test_main_dedupeTargets(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port := tsURL.Port()
+
+	// the same IP is given as single one, within CIDR and within range
+	inputs := []string{tsURL.Host, "127.0.0.0/30:" + port, "127.0.0.1-2:" + port}
+	for dedupe, results := range map[bool]int{false: 3, true: 1} {
+		os.Args = append([]string{"cero-test", "-v", fmt.Sprintf("-dedupe-targets=%t", dedupe)}, inputs...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, results, strings.Count(output, tsURL.Host+" -- ["), dedupe)
+		if dedupe {
+			assert.Contains(t, output, "3 duplicate targets skipped")
+		}
+	}
+}
+
+func Test_main_listOnly(t *testing.T) {
+	os.Args = []string{"cero-test", "-list-only", "-p", "443,8443", "10.0.0.0/31", "[2001:db8::1]:25", "example.com"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.ElementsMatch(t, []string{
+		"10.0.0.0:443", "10.0.0.0:8443", "10.0.0.1:443", "10.0.0.1:8443",
+		"[2001:db8::1]:25",
+		"example.com:443", "example.com:8443",
+	}, strings.Fields(output))
+
+	// limit of targets
+	os.Args = []string{"cero-test", "-list-only", "-shuffle", "-max", "3", "10.0.0.0/24"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Len(t, strings.Fields(output), 3)
+}
+
+func Test_main_firstPort(t *testing.T) {
+	ts1 := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts1.Close()
+	ts2 := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts2.Close()
+
+	// addresses, nobody listens at
+	closedAddr := func() string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer l.Close()
+		return l.Addr().String()
+	}
+	closedAddr1, closedAddr2 := closedAddr(), closedAddr()
+
+	_, closedPort1, _ := net.SplitHostPort(closedAddr1)
+	_, closedPort2, _ := net.SplitHostPort(closedAddr2)
+	_, port1, _ := net.SplitHostPort(ts1.Listener.Addr().String())
+	_, port2, _ := net.SplitHostPort(ts2.Listener.Addr().String())
+
+	// the first port fails, the second one answers, the third one is not tried
+	os.Args = []string{"cero-test", "-v", "-first-port", "-p", strings.Join([]string{closedPort1, port1, port2}, ","), "127.0.0.1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, ts1.Listener.Addr().String()+" -- [")
+	assert.NotContains(t, output, closedAddr1)
+	assert.NotContains(t, output, ts2.Listener.Addr().String())
+
+	// none answers: error of the last port is output
+	os.Args = []string{"cero-test", "-v", "-first-port", "-p", closedPort1 + "," + closedPort2, "127.0.0.1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.NotContains(t, output, closedAddr1)
+	assert.Contains(t, output, closedAddr2+" -- ")
+}
+
+func Test_main_portFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# web\n443\n8443 # alt\n\n9000-9001,443\n"), 0o644))
+
+	// ports of file replace default one
+	os.Args = []string{"cero-test", "-list-only", "-port-file", path, "example.com"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, []string{"example.com:443", "example.com:8443", "example.com:9000", "example.com:9001"}, strings.Fields(output))
+
+	// combined with -p
+	os.Args = []string{"cero-test", "-list-only", "-p", "25,8443", "-port-file", path, "example.com"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.ElementsMatch(t, []string{"example.com:25", "example.com:443", "example.com:8443", "example.com:9000", "example.com:9001"}, strings.Fields(output))
+}
+
+func Test_main_skipNetworkBroadcast(t *testing.T) {
+	os.Args = []string{"cero-test", "-list-only", "-skip-network-broadcast", "10.0.0.0/30", "10.0.1.0/31"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.ElementsMatch(t, []string{"10.0.0.1:443", "10.0.0.2:443", "10.0.1.0:443", "10.0.1.1:443"}, strings.Fields(output))
+
+	os.Args = []string{"cero-test", "-dry-run", "-skip-network-broadcast", "10.0.0.0/24"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "10.0.0.0/24 -- 254 IPs, 254 targets")
+}
+
+func Test_main_inlineSNI(t *testing.T) {
+	// server records SNI it receives
+	var sni []string
+	var mu sync.Mutex
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, &x509.Certificate{NotAfter: time.Now().Add(time.Hour)})},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			sni = append(sni, hello.ServerName)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	tests := []struct {
+		args []string
+		sni  string
+	}{
+		{[]string{tsURL.Host + "@foo.example.com"}, "foo.example.com"},
+		{[]string{"127.0.0.1/32:" + tsURL.Port() + "@foo.example.com"}, "foo.example.com"},
+		// global SNI is overridden
+		{[]string{"-sni", "bar.example.com", tsURL.Host + "@foo.example.com"}, "foo.example.com"},
+		{[]string{"-sni", "bar.example.com", tsURL.Host}, "bar.example.com"},
+		{[]string{tsURL.Host}, ""},
+	}
+	for _, tt := range tests {
+		sni = nil
+		os.Args = append([]string{"cero-test"}, tt.args...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		captureOutput(main)
+		assert.Equal(t, []string{tt.sni}, sni, tt.args)
+	}
+
+	// invalid server name is reported as error of input item
+	os.Args = []string{"cero-test", "-v", tsURL.Host + "@"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	assert.Contains(t, captureOutput(main), tsURL.Host+"@ -- other: ")
+}
+
+func Test_main_sniPool(t *testing.T) {
+	// server records SNI it receives
+	received := make(map[string]int)
+	var mu sync.Mutex
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: time.Now().Add(time.Hour)})},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			received[hello.ServerName]++
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// every target gets SNI of the pool, and reports it
+	tsURL, _ := url.Parse(ts.URL)
+	os.Args = []string{"cero-test", "-v", "-sni-pool", "a.example.com, b.example.com"}
+	for i := 0; i < 20; i++ {
+		os.Args = append(os.Args, tsURL.Host)
+	}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	reported := strings.Count(output, " -- sni: a.example.com") + strings.Count(output, " -- sni: b.example.com")
+	assert.Equal(t, 20, reported, output)
+	assert.Equal(t, 20, received["a.example.com"]+received["b.example.com"], received)
+
+	// SNI given with input overrides the pool
+	os.Args = []string{"cero-test", "-json", "-sni-pool", "a.example.com", tsURL.Host + "@c.example.com", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	var snis []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record jsonResult
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record), line) {
+			snis = append(snis, record.SNI)
+		}
+	}
+	assert.ElementsMatch(t, []string{"", "a.example.com"}, snis)
+	assert.Equal(t, 1, received["c.example.com"])
+}
+
+func Test_main_ids(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	// the same target is given twice, and input file comes after arguments
+	tsURL, _ := url.Parse(ts.URL)
+	path := filepath.Join(t.TempDir(), "targets.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# comment\n"+tsURL.Hostname()+":99999\n"), 0o644))
+
+	os.Args = []string{"cero-test", "-json", "-ids", "-i", path, tsURL.Host, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	ids := make(map[uint64]bool)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record jsonResult
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record), line) {
+			ids[record.ID] = record.Error == nil
+		}
+	}
+	assert.Equal(t, map[uint64]bool{1: true, 2: true, 3: false}, ids)
+
+	os.Args = []string{"cero-test", "-v", "-ids", tsURL.Host, tsURL.Hostname() + ":99999"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, tsURL.Host+" -- id: 1 -- [")
+	assert.Contains(t, output, tsURL.Hostname()+":99999 -- id: 2 -- other: ")
+}
+
+func Test_main_invalidPort(t *testing.T) {
+	// bad port of a target is reported as its error, the rest of targets is processed
+	os.Args = []string{"cero-test", "-v", "-dry-run", "example.com:70000", "10.0.0.0/30:abc", "10.0.0.0/30"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, `example.com:70000 -- other: invalid port: "70000" (must be a number within 1-65535)`)
+	assert.Contains(t, output, `10.0.0.0/30:abc -- other: invalid port: "abc" (must be a number within 1-65535)`)
+	assert.Contains(t, output, "10.0.0.0/30 -- 4 IPs, 4 targets")
+}
+
+func Test_main_groupHost(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	host, port := cero.SplitHostPort(tsURL.Host)
+
+	// grab port, that is closed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort := cero.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	os.Args = []string{"cero-test", "-v", "-group-host", "-p", port + "," + closedPort, host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], fmt.Sprintf("%s: [", port))
+	assert.Contains(t, lines[0], fmt.Sprintf("%s: refused: dial tcp", closedPort))
+}
+
+func Test_main_errorsOnly(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// grab port, that is closed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	os.Args = []string{"cero-test", "-errors-only", "refused,timeout", tsURL.Host, closedAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, closedAddr+" -- refused: dial tcp"), output)
+	assert.Len(t, strings.Split(strings.TrimSpace(output), "\n"), 1)
+
+	// class of error in JSON record
+	os.Args = []string{"cero-test", "-json", "-errors-only", "refused", tsURL.Host, closedAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	var record map[string]interface{}
+	output = captureOutput(main)
+	assert.NoError(t, json.Unmarshal([]byte(output), &record))
+	assert.Equal(t, "refused", record["error_class"])
+	assert.Equal(t, closedAddr, record["addr"])
+}
+
+func Test_main_outFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// grab port, that is closed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	outPath := filepath.Join(t.TempDir(), "results.txt")
+	os.Args = []string{"cero-test", "-v", "-o", outPath, tsURL.Host, closedAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Empty(t, output)
+
+	content, err := os.ReadFile(outPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), tsURL.Host+" -- [")
+	assert.Contains(t, string(content), closedAddr+" -- refused: ")
+}
+
+func Test_main_ptr(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	var lookups int32
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		if addr == "127.0.0.1" {
+			return []string{"localhost."}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	defer func() { lookupAddr = net.DefaultResolver.LookupAddr }()
+
+	// the same IP is scanned twice, but looked up once
+	tsURL, _ := url.Parse(ts.URL)
+	os.Args = []string{"cero-test", "-json", "-ptr", tsURL.Host, tsURL.Host, "127.0.0.2:" + tsURL.Port()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	for _, line := range lines {
+		var record jsonResult
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record), line) {
+			if record.Host == "127.0.0.1" {
+				assert.Equal(t, []string{"localhost"}, record.PTR)
+			} else {
+				assert.Empty(t, record.PTR)
+			}
+		}
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&lookups))
+
+	// verbose output
+	os.Args = []string{"cero-test", "-v", "-ptr", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, " -- ptr: localhost")
+}
+
+func Test_main_emptyCommonName(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		DNSNames: []string{"example.com", "www.example.com", "api.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	// no blank names, neither in plain nor in verbose output
+	tsURL, _ := url.Parse(ts.URL)
+	os.Args = []string{"cero-test", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "example.com\nwww.example.com\napi.example.com\n", output)
+
+	os.Args = []string{"cero-test", "-v", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, tsURL.Host+" -- [example.com www.example.com api.example.com] -- ")
+}
+
+func Test_main_stripTrailingDot(t *testing.T) {
+	// the same name is presented in both forms by different servers
+	dotted := newTestServer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com."}, DNSNames: []string{"www.example.com."}, NotAfter: time.Now().Add(time.Hour)})
+	defer dotted.Close()
+	plain := newTestServer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"www.example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	defer plain.Close()
+
+	dottedURL, _ := url.Parse(dotted.URL)
+	plainURL, _ := url.Parse(plain.URL)
+	for _, tt := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-strip-trailing-dot"}, []string{"example.com", "example.com", "www.example.com", "www.example.com"}},
+		{[]string{"-strip-trailing-dot", "-unique"}, []string{"example.com", "www.example.com"}},
+		{nil, []string{"example.com", "example.com.", "www.example.com", "www.example.com."}},
+	} {
+		os.Args = append(append([]string{"cero-test"}, tt.args...), dottedURL.Host, plainURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := strings.Fields(captureOutput(main))
+		sort.Strings(output)
+		assert.Equal(t, tt.expected, output, tt.args)
+	}
+}
+
+func Test_main_cnOnly_sansOnly(t *testing.T) {
+	// CommonName is among SANs
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com", "example.com", "*.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	for _, tt := range []struct {
+		args     []string
+		expected []string
+	}{
+		{nil, []string{"www.example.com", "example.com", "*.example.com"}},
+		{[]string{"-cn-only"}, []string{"www.example.com"}},
+		{[]string{"-sans-only"}, []string{"www.example.com", "example.com", "*.example.com"}},
+		{[]string{"-sans-only", "-d"}, []string{"www.example.com", "example.com"}},
+	} {
+		os.Args = append(append([]string{"cero-test"}, tt.args...), tsURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, tt.expected, strings.Fields(output), tt.args)
+	}
+}
+
+func Test_main_quic(t *testing.T) {
+	cert := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h3"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			if _, err := listener.Accept(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+
+	os.Args = []string{"cero-test", "-v", "-quic", listener.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, listener.Addr().String()+" -- [example.com] -- ")
+	assert.Contains(t, output, "tls: TLS 1.3")
+}
+
+func Test_main_autoSTARTTLS(t *testing.T) {
+	// PostgreSQL server on its well-known port, that expects SSLRequest before TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.2:5432")
+	if err != nil {
+		t.Skip("can not listen on 127.0.0.2:5432:", err)
+	}
+	defer listener.Close()
+
+	cert := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "db.example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				request := make([]byte, 8)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				if _, err := conn.Write([]byte("S")); err != nil {
+					return
+				}
+				_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+			}()
+		}
+	}()
+
+	// TLS is expected immediately on other ports
+	ts := newTestServer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "www.example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-auto-starttls", "-sort", "127.0.0.2:5432", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, []string{"db.example.com", "www.example.com"}, strings.Fields(output))
+}
+
+func Test_main_json(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	host, port := cero.SplitHostPort(tsURL.Host)
+
+	// every IP of CIDR produces its own record
+	os.Args = []string{"cero-test", "-json", fmt.Sprintf("%s/30:%s", host, port)}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 4)
+
+	records := make(map[string]map[string]interface{})
+	for _, line := range lines {
+		var record map[string]interface{}
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record), line) {
+			records[record["addr"].(string)] = record
+		}
+	}
+
+	// successful record
+	record := records[tsURL.Host]
+	if assert.NotNil(t, record) {
+		assert.Nil(t, record["error"])
+		assert.Contains(t, record["names"], "example.com")
+		assert.Equal(t, host, record["host"])
+		assert.EqualValues(t, tsURL.Port(), fmt.Sprint(record["port"]))
+		assert.Equal(t, "TLS 1.3", record["tls_version"])
+		assert.Equal(t, "TLS_AES_128_GCM_SHA256", record["cipher_suite"])
+		assert.Nil(t, record["cert"])
+
+		ts, err := time.Parse(time.RFC3339, record["ts"].(string))
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), ts, time.Minute)
+	}
+
+	// failed record
+	record = records[net.JoinHostPort("127.0.0.0", port)]
+	if assert.NotNil(t, record) {
+		assert.Nil(t, record["names"])
+		assert.NotEmpty(t, record["error"])
+	}
+}
+
+func Test_main_tlsVersion(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "tls: TLS 1.3, "},
+		{[]string{"-max-version", "1.2"}, "tls: TLS 1.2, "},
+		{[]string{"-min-version", "1.2", "-max-version", "1.2"}, "tls: TLS 1.2, "},
+		{[]string{"-min-version", "1.0", "-max-version", "1.1"}, "handshake: "}, // server refuses legacy TLS
+	}
+	for _, tt := range tests {
+		os.Args = append(append([]string{"cero-test", "-v"}, tt.args...), tsURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Contains(t, output, tt.expected, tt.args)
+	}
+}
+
+func Test_main_alpn(t *testing.T) {
+	h1 := httptest.NewTLSServer(http.NotFoundHandler())
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(http.NotFoundHandler())
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	h1URL, _ := url.Parse(h1.URL)
+	h2URL, _ := url.Parse(h2.URL)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-alpn", "h2,http/1.1", h1URL.Host}, "alpn: http/1.1"},
+		{[]string{"-alpn", "h2,http/1.1", h2URL.Host}, "alpn: h2"},
+	}
+	for _, tt := range tests {
+		os.Args = append([]string{"cero-test", "-v"}, tt.args...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Contains(t, output, tt.expected, tt.args)
+	}
+
+	// nothing advertised by default
+	os.Args = []string{"cero-test", "-v", h2URL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.NotContains(t, output, "alpn:")
+}
+
+func Test_main_certJSON(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "example.com"},
+		DNSNames:    []string{"example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		NotAfter:    time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-cert-json", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	var record struct {
+		Names []string
+		Cert  map[string]interface{}
+	}
+	if assert.NoError(t, json.Unmarshal([]byte(output), &record), output) {
+		assert.Equal(t, []string{"example.com"}, record.Names)
+		assert.Equal(t, "example.com", record.Cert["subject_cn"])
+		assert.Equal(t, []interface{}{"10.0.0.1"}, record.Cert["ip_addresses"])
+		assert.Equal(t, "ECDSA", record.Cert["pubkey_alg"])
+	}
+}
+
+func Test_main_ndjson(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// capture output with pipe, to read records while scan is running
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	// feed stdin with pipe, to keep scan running until first record is read
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = stdinReader
+	defer func() { os.Stdin = stdin }()
+
+	os.Args = []string{"cero-test", "-ndjson"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	done := make(chan struct{})
+	go func() {
+		main()
+		close(done)
+	}()
+
+	// record is available before input is over
+	fmt.Fprintln(stdinWriter, tsURL.Host)
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Contains(t, line, `"addr":"`+tsURL.Host+`"`)
+
+	stdinWriter.Close()
+	<-done
+	writer.Close()
+}
+
+func Test_main_rr(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	// same target twice must not produce duplicate records
+	os.Args = []string{"cero-test", "-rr", tsURL.Host, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, len(ts.Certificate().DNSNames))
+	assert.Contains(t, lines, "example.com. IN A 127.0.0.1")
+}
+
+func Test_main_rr_grouped(t *testing.T) {
+	// any IP of loopback network can be bound only on Linux
+	if runtime.GOOS != "linux" {
+		t.Skip("binding to 127.0.0.2 requires Linux")
+	}
+
+	// name, found on two IPs
+	var addrs []string
+	for _, server := range []struct{ ip, name string }{{"127.0.0.1", "a.example.com"}, {"127.0.0.2", "b.example.com"}} {
+		ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+		ln, err := net.Listen("tcp", server.ip+":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.Listener.Close()
+		ts.Listener = ln
+		ts.TLS = &tls.Config{Certificates: []tls.Certificate{newTestCertificate(t, &x509.Certificate{DNSNames: []string{server.name, "example.com"}, NotAfter: time.Now().Add(time.Hour)})}}
+		ts.StartTLS()
+		defer ts.Close()
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	os.Args = append([]string{"cero-test", "-rr", "-sort"}, addrs...)
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, []string{"a.example.com. IN A 127.0.0.1", "b.example.com. IN A 127.0.0.2"}, lines[:2])
+		assert.ElementsMatch(t, []string{"example.com. IN A 127.0.0.1", "example.com. IN A 127.0.0.2"}, lines[2:])
+	}
+}
+
+func Test_main_retries(t *testing.T) {
+	// listener that accepts connections, but never responds
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			defer conn.Close()
+		}
+	}()
+
+	os.Args = []string{"cero-test", "-v", "-t", "1", "-r", "1", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "i/o timeout")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&accepted))
+
+	// long form of the flag
+	atomic.StoreInt32(&accepted, 0)
+	os.Args = []string{"cero-test", "-v", "-t", "1", "-retries", "0", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	captureOutput(main)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&accepted))
+}
+
+func Test_main_retries_resets(t *testing.T) {
+	// listener that reads ClientHello, then resets connection
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			_, _ = conn.Read(make([]byte, 1024))
+			_ = conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+		}
+	}()
+
+	// resets are fatal by default
+	os.Args = []string{"cero-test", "-v", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "reset: ")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&accepted))
+
+	// explicit retries cover resets too
+	for _, arg := range []string{"-r", "-retries"} {
+		atomic.StoreInt32(&accepted, 0)
+		os.Args = []string{"cero-test", "-v", arg, "2", ln.Addr().String()}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		captureOutput(main)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&accepted), arg)
+	}
+}
+
+// runs main in subprocess (test binary itself) with args, for failures that exit the process.
+// returns its stderr and exit code
+func runMainProcess(t *testing.T, args ...string) (string, int) {
+	if os.Getenv("CERO_TEST_MAIN") == "1" {
+		t.Fatal("runMainProcess must not be called from subprocess")
+	}
+	// os.Args are replaced by other tests
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(executable, "-test.run=^Test_mainProcess$")
+	cmd.Env = append(os.Environ(), "CERO_TEST_MAIN=1", "CERO_TEST_ARGS="+strings.Join(args, "\n"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stderr.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stderr.String(), 0
+}
+
+// entry point of subprocess, started by runMainProcess
+func Test_mainProcess(t *testing.T) {
+	if os.Getenv("CERO_TEST_MAIN") != "1" {
+		t.Skip("runs only as subprocess")
+	}
+	os.Args = append([]string{"cero-test"}, strings.Split(os.Getenv("CERO_TEST_ARGS"), "\n")...)
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	main()
+}
+
+func Test_main_invalidInputConcurrency(t *testing.T) {
+	for _, ic := range []string{"0", "-1"} {
+		stderr, code := runMainProcess(t, "-ic", ic, "127.0.0.1:1")
+		assert.Equal(t, exitUsage, code, ic)
+		assert.Contains(t, stderr, "invalid -ic: "+ic, ic)
+	}
+}
+
+func Test_processInputItem_cancelled(t *testing.T) {
+	options.Ports = []string{"443"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads input channel: feeding must stop on cancellation instead of blocking
+	chanInput := make(chan *procTarget)
+	chanResult := make(chan *procResult)
+	for _, item := range []string{"example.com", "10.0.0.0/16"} {
+		processInputItem(ctx, item, 1, chanInput, chanResult)
+	}
+}
+
+func Test_main_max(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	host, port := cero.SplitHostPort(tsURL.Host)
+
+	os.Args = []string{"cero-test", "-v", "-max", "1", "-p", port + ",1", host, "10.0.0.0/30"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, tsURL.Host+" -- ")
+	assert.NotContains(t, output, "10.0.0.")
+	assert.Contains(t, output, "limit of 1 targets reached, 9 targets skipped")
+}
+
+func Test_main_dryRun(t *testing.T) {
+	os.Args = []string{"cero-test", "-dry-run", "-p", "443,8443", "10.0.0.0/8", "::/64:443", "10.0.0.1-10.0.1.0", "example.com", "10.0.0.0/30:8000-8099"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.ElementsMatch(t, []string{
+		"10.0.0.0/8 -- 16777216 IPs, 33554432 targets",
+		"::/64 -- at least 2^64 IPs, at least 2^64 targets",
+		"10.0.0.1-10.0.1.0 -- 256 IPs, 512 targets",
+		"10.0.0.0/30 -- 4 IPs, 400 targets",
+	}, lines)
+
+	// ranges of default ports
+	os.Args = []string{"cero-test", "-dry-run", "-p", "443,8000-8099", "10.0.0.0/30"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Equal(t, "10.0.0.0/30 -- 4 IPs, 404 targets", strings.TrimSpace(output))
+
+	// estimates go to output file
+	outPath := filepath.Join(t.TempDir(), "estimates.txt")
+	os.Args = []string{"cero-test", "-dry-run", "-o", outPath, "10.0.0.0/30"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Empty(t, output)
+	written, err := os.ReadFile(outPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "10.0.0.0/30 -- 4 IPs, 4 targets\n", string(written))
+	}
+}
+
+func Test_processInputItem_shuffle(t *testing.T) {
+	options.Ports = []string{"443"}
+	dryRun, maxTargets, shuffle = false, 0, true
+	defer func() { shuffle = false }()
+
+	var expected []string
+	for i := 0; i < 16; i++ {
+		expected = append(expected, fmt.Sprintf("10.0.0.%d:443", i))
+	}
+
+	for _, item := range []string{"10.0.0.0/28", "10.0.0.0-15"} {
+		chanInput := make(chan *procTarget)
+		go func() {
+			processInputItem(context.Background(), item, 1, chanInput, nil)
+			close(chanInput)
+		}()
+
+		var addrs []string
+		for target := range chanInput {
+			addrs = append(addrs, target.addr)
+		}
+		assert.ElementsMatch(t, expected, addrs, item)
+	}
+}
+
+func Test_main_hugeCIDR(t *testing.T) {
+	os.Args = []string{"cero-test", "-yes", "-max", "1", "-p", "1", "127.0.0.0/8"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "warning: 127.0.0.0/8 expands to 16777216 IPs")
+}
+
+func Test_targetCounts(t *testing.T) {
+	assert.Equal(t, uint64(4), cidrSize("10.0.0.0/30", false))
+	assert.Equal(t, uint64(1<<32), cidrSize("0.0.0.0/0", false))
+	assert.Equal(t, uint64(math.MaxUint64), cidrSize("::/64", false))
+
+	// network and broadcast addresses are skipped
+	assert.Equal(t, uint64(254), cidrSize("10.0.0.0/24", true))
+	assert.Equal(t, uint64(2), cidrSize("10.0.0.0/31", true))
+	assert.Equal(t, uint64(1), cidrSize("10.0.0.0/32", true))
+	assert.Equal(t, uint64(256), cidrSize("fe80::/120", true))
+	assert.Equal(t, uint64(math.MaxUint64), satAdd(math.MaxUint64, 1))
+	assert.Equal(t, uint64(math.MaxUint64), satMul(math.MaxUint64, 2))
+	assert.Equal(t, uint64(0), satSub(1, 2))
+}
+
+func Test_main_expiredOnly(t *testing.T) {
+	// server with expired certificate
+	expired := newTestServer(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "expired.example.com"},
+		NotBefore: time.Now().Add(-48 * time.Hour),
+		NotAfter:  time.Now().Add(-24 * time.Hour),
+	})
+	defer expired.Close()
+
+	// server with valid certificate
+	valid := newTestServer(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "valid.example.com"},
+		NotBefore: time.Now().Add(-24 * time.Hour),
+		NotAfter:  time.Now().Add(24 * time.Hour),
+	})
+	defer valid.Close()
+
+	expiredURL, _ := url.Parse(expired.URL)
+	validURL, _ := url.Parse(valid.URL)
+
+	os.Args = []string{"cero-test", "-expired-only", expiredURL.Host, validURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "expired.example.com", strings.TrimSpace(output))
+
+	// verbose mode tells how long ago certificate has expired
+	os.Args = []string{"cero-test", "-v", "-expired-only", expiredURL.Host, validURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "[expired.example.com]")
+	assert.Contains(t, output, "-- expired 24h0m")
+	assert.NotContains(t, output, "valid.example.com")
+}
+
+func Benchmark_processInput(b *testing.B) {
+	options.Ports = []string{"443"}
+
+	for _, ic := range []int{1, 4} {
+		b.Run(fmt.Sprintf("ic=%d", ic), func(b *testing.B) {
+			inputConcurrency = ic
+
+			chanItems := make(chan *inputItem)
+			chanInput := make(chan *procTarget)
+			chanResult := make(chan *procResult)
+
+			// feed items
+			go func() {
+				for i := 0; i < b.N; i++ {
+					chanItems <- &inputItem{id: uint64(i + 1), text: "10.0.0.0/28"}
+				}
+				close(chanItems)
+			}()
+
+			// drain atomic addresses
+			done := make(chan struct{})
+			go func() {
+				for range chanInput {
+				}
+				close(done)
+			}()
+
+			b.ResetTimer()
+			processInput(context.Background(), chanItems, chanInput, chanResult)
+			close(chanInput)
+			<-done
+		})
+	}
+}
+
+func Test_main_expiring(t *testing.T) {
+	expiring := newTestServer(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "expiring.example.com"},
+		NotBefore: time.Now().Add(-24 * time.Hour),
+		NotAfter:  time.Now().Add(24 * time.Hour),
+	})
+	defer expiring.Close()
+
+	valid := newTestServer(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "valid.example.com"},
+		NotBefore: time.Now().Add(-24 * time.Hour),
+		NotAfter:  time.Now().AddDate(0, 0, 30),
+	})
+	defer valid.Close()
+
+	expiringURL, _ := url.Parse(expiring.URL)
+	validURL, _ := url.Parse(valid.URL)
+
+	os.Args = []string{"cero-test", "-expiring", "7", expiringURL.Host, validURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "expiring.example.com", strings.TrimSpace(output))
+
+	// verbose mode shows validity period
+	os.Args = []string{"cero-test", "-v", validURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, "to "+time.Now().AddDate(0, 0, 30).UTC().Format("2006-01-02"))
+}
+
+func Test_main_issuerFilter(t *testing.T) {
+	// test server certificate is issued by Acme Co
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-v", "-issuer-filter", "acme", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "issuer: O=Acme Co")
+
+	os.Args = []string{"cero-test", "-v", "-issuer-filter", "Let's Encrypt", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Empty(t, output)
+}
+
+func Test_main_uniqueCerts(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	sum := sha256.Sum256(ts.Certificate().Raw)
+
+	// same certificate is output only once
+	os.Args = []string{"cero-test", "-v", "-unique-certs", tsURL.Host, tsURL.Host, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, 1, strings.Count(output, "sha256: "+hex.EncodeToString(sum[:])))
+}
+
+func Test_main_unique(t *testing.T) {
+	first := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "a.example.com"},
+		DNSNames: []string{"a.example.com", "b.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer first.Close()
+	second := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "A.Example.COM."},
+		DNSNames: []string{"c.example.com", "B.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer second.Close()
+
+	firstURL, _ := url.Parse(first.URL)
+	secondURL, _ := url.Parse(second.URL)
+
+	os.Args = []string{"cero-test", "-unique", firstURL.Host, secondURL.Host, firstURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	var names []string
+	for _, name := range strings.Split(strings.TrimSpace(output), "\n") {
+		names = append(names, normalizeName(name))
+	}
+	assert.ElementsMatch(t, []string{"a.example.com", "b.example.com", "c.example.com"}, names)
+}
+
+func Test_main_matchDomain(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com", "evilexample.com", "api.foo.net"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-match-domain", "example.com,foo.net", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "www.example.com\napi.foo.net", strings.TrimSpace(output))
+
+	// nothing survives: empty list in verbose mode
+	os.Args = []string{"cero-test", "-v", "-match-domain", "example.org", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, tsURL.Host+" -- [] -- "), output)
+}
+
+func Test_main_grep(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com", "dev-api.example.com", "stg-web.example.com", "192.168.0.1"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-grep", "^(dev|stg)-"}, "dev-api.example.com\nstg-web.example.com"},
+		{[]string{"-grep-v", "^(dev|stg)-"}, "www.example.com\n192.168.0.1"},
+		{[]string{"-d", "-grep", "example", "-grep-v", "^stg"}, "www.example.com\ndev-api.example.com"},
+	}
+	for _, tt := range tests {
+		os.Args = append(append([]string{"cero-test"}, tt.args...), tsURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, tt.expected, strings.TrimSpace(output), tt.args)
+	}
+}
+
+func Test_main_sni(t *testing.T) {
+	vhost := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "vhost.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	fallback := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "default.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+
+	// server presents certificate depending on SNI
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{fallback},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "localhost" {
+				return &vhost, nil
+			}
+			return &fallback, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	domainAddr := net.JoinHostPort("localhost", tsURL.Port())
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{domainAddr}, "vhost.example.com"},
+		{[]string{"-no-sni", domainAddr}, "default.example.com"},
+		{[]string{tsURL.Host}, "default.example.com"}, // no SNI for IPs
+		{[]string{"-sni", "localhost", tsURL.Host}, "vhost.example.com"},
+		{[]string{"-sni", "localhost", fmt.Sprintf("%s/32:%s", tsURL.Hostname(), tsURL.Port())}, "vhost.example.com"},
+		{[]string{"-sni", "other.example.com", domainAddr}, "default.example.com"},
+		{[]string{"-resolve-all", "-p", tsURL.Port(), "localhost"}, "vhost.example.com"}, // IP is dialed with SNI of domain name
+		{[]string{"-resolve-all", "-no-sni", domainAddr}, "default.example.com"},
+	}
+	for _, tt := range tests {
+		os.Args = append([]string{"cero-test"}, tt.args...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, tt.expected, strings.TrimSpace(output), tt.args)
+	}
+}
+
+func Test_main_recurse(t *testing.T) {
+	first := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "a.example.com"},
+		DNSNames: []string{"a.example.com", "b.example.com", "*.example.com", "127.0.0.1"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer first.Close()
+	second := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "b.example.com"},
+		DNSNames: []string{"b.example.com", "c.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer second.Close()
+
+	firstURL, _ := url.Parse(first.URL)
+	secondURL, _ := url.Parse(second.URL)
+
+	// b and c resolve to the second server (a is given as input, so it is resolved only to be dialed, and does not exist)
+	var mu sync.Mutex
+	var resolved []string
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		mu.Lock()
+		resolved = append(resolved, host)
+		mu.Unlock()
+		if host == "b.example.com" || host == "c.example.com" {
+			return []net.IPAddr{{IP: net.ParseIP(secondURL.Hostname())}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	defer func() { lookupIPAddr = net.DefaultResolver.LookupIPAddr }()
+
+	tests := []struct {
+		args     []string
+		results  int
+		resolved []string
+	}{
+		{nil, 0, []string{"a.example.com"}},
+		{[]string{"-recurse"}, 1, []string{"a.example.com", "b.example.com"}},
+		{[]string{"-recurse", "-depth", "2"}, 2, []string{"a.example.com", "b.example.com", "c.example.com"}},
+		{[]string{"-recurse", "-depth", "10"}, 2, []string{"a.example.com", "b.example.com", "c.example.com"}}, // no loops
+	}
+	for _, tt := range tests {
+		resolved = nil
+		os.Args = append(append([]string{"cero-test", "-v", "-p", secondURL.Port()}, tt.args...), "a.example.com", firstURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, tt.results, strings.Count(output, secondURL.Host+" -- ["), tt.args, output)
+		assert.ElementsMatch(t, tt.resolved, resolved, tt.args)
+	}
+}
+
+func Test_main_fullChain(t *testing.T) {
+	leaf := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com", "example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	intermediate := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "Example CA", Organization: []string{"Example"}},
+		DNSNames: []string{"ca.example.net", "example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	leaf.Certificate = append(leaf.Certificate, intermediate.Certificate...)
+
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "www.example.com\nexample.com"},
+		{[]string{"-full-chain"}, "www.example.com\nexample.com\nExample CA\nca.example.net"},
+		{[]string{"-full-chain", "-d"}, "www.example.com\nexample.com\nca.example.net"},
+	}
+	for _, tt := range tests {
+		os.Args = append(append([]string{"cero-test"}, tt.args...), tsURL.Host)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.Equal(t, tt.expected, strings.TrimSpace(output), tt.args)
+	}
+
+	// verbose: names of every certificate separately
+	os.Args = []string{"cero-test", "-v", "-full-chain", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, " -- #0 CN=www.example.com (issuer: CN=www.example.com): [www.example.com example.com]")
+	assert.Contains(t, output, " -- #1 CN=Example CA, O=Example (issuer: CN=Example CA, O=Example): [Example CA ca.example.net example.com]")
+}
+
+func Test_main_showAddr(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "www.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	domainAddr := net.JoinHostPort("localhost", tsURL.Port())
+
+	os.Args = []string{"cero-test", "-show-addr", domainAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, fmt.Sprintf("example.com [%[1]s]\nwww.example.com [%[1]s]", tsURL.Host), strings.TrimSpace(output))
+
+	os.Args = []string{"cero-test", "-v", "-show-addr", domainAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, domainAddr+" -- remote: "+tsURL.Host+" -- [example.com www.example.com]"), output)
+
+	os.Args = []string{"cero-test", "-json", "-show-addr", domainAddr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.Contains(t, output, `"remote_addr":"`+tsURL.Host+`"`)
+}
+
+func Test_main_deadline(t *testing.T) {
+	// listener that accepts connections, but never responds
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	exitCode := 0
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = os.Exit }()
+
+	addr := ln.Addr().String()
+	os.Args = []string{"cero-test", "-v", "-c", "1", "-t", "10", "-deadline", "200ms", addr, addr, addr}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	start := time.Now()
+	output := captureOutput(main)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, exitIncomplete, exitCode)
+	assert.Contains(t, output, addr+" -- cancelled: ")
+	assert.Regexp(t, `deadline of 200ms exceeded, [1-3] targets left unprocessed`, output)
+
+	// run that completes in time exits normally
+	exitCode = 0
+	os.Args = []string{"cero-test", "-deadline", "1m", "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	captureOutput(main)
+	assert.Equal(t, 0, exitCode)
+}
+
+func Test_main_rate(t *testing.T) {
+	// connections are spread in time, regardless of concurrency
+	os.Args = []string{"cero-test", "-c", "10", "-r", "0", "-rate", "10", "127.0.0.1:1", "127.0.0.1:1", "127.0.0.1:1", "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	start := time.Now()
+	captureOutput(main)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+
+	// workers waiting for their turn are stopped by deadline
+	exit = func(code int) {}
+	defer func() { exit = os.Exit }()
+
+	os.Args = []string{"cero-test", "-c", "10", "-rate", "0.1", "-deadline", "200ms", "127.0.0.1:1", "127.0.0.1:1", "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	start = time.Now()
+	captureOutput(main)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func Test_main_resolver(t *testing.T) {
+	defer func() { lookupIPAddr = net.DefaultResolver.LookupIPAddr }()
+
+	// DNS server, that does not answer (port is closed)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := conn.LocalAddr().String()
+	conn.Close()
+
+	// failure to resolve is reported as any other error, both for names to dial and names to resolve up front
+	for _, resolveAll := range []string{"-resolve-all=false", "-resolve-all=true"} {
+		os.Args = []string{"cero-test", "-v", "-r", "0", resolveAll, "-resolver", server, "example.test"}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.True(t, strings.HasPrefix(output, "example.test"), output)
+		assert.Contains(t, output, " -- dns: ", resolveAll)
+	}
+}
+
+func Test_main_doh(t *testing.T) {
+	defer func() { lookupIPAddr = net.DefaultResolver.LookupIPAddr }()
+
+	// DoH endpoint, that fails every query
+	var queries int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	for _, resolveAll := range []string{"-resolve-all=false", "-resolve-all=true"} {
+		os.Args = []string{"cero-test", "-v", "-r", "0", resolveAll, "-doh", ts.URL, "example.test"}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		output := captureOutput(main)
+		assert.True(t, strings.HasPrefix(output, "example.test"), output)
+		assert.Contains(t, output, " -- dns: ", resolveAll)
+	}
+	assert.NotZero(t, atomic.LoadInt32(&queries))
+}
+
+func Test_main_clientCert(t *testing.T) {
+	// server that requires client certificate
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "internal.example.com"},
+			NotAfter: time.Now().Add(time.Hour),
+		})},
+		ClientAuth: tls.RequireAnyClientCert,
+		MaxVersion: tls.VersionTLS12,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	tsURL, _ := url.Parse(ts.URL)
+
+	// client keypair as PEM files
+	cert := newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, NotAfter: time.Now().Add(time.Hour)})
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Args = []string{"cero-test", "-v", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, tsURL.Host+" -- client-cert: "), output)
+
+	os.Args = []string{"cero-test", "-v", "-cert", certFile, "-key", keyFile, tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, tsURL.Host+" -- [internal.example.com]"), output)
+}
+
+func Test_main_hostnameMatch(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	domainAddr := net.JoinHostPort("localhost", tsURL.Port())
+
+	tests := []struct {
+		args     []string
+		verbose  string // part of verbose output, expected to be present (or absent, if it's prefixed with !)
+		jsonPart string
+	}{
+		{[]string{domainAddr}, "hostname mismatch: localhost", `"hostname_match":false`},
+		{[]string{"-sni", "example.com", domainAddr}, "!hostname mismatch", `"hostname_match":true`},
+		{[]string{tsURL.Host}, "!hostname mismatch", "!hostname_match"},
+	}
+	for _, tt := range tests {
+		for _, mode := range []string{"-v", "-json"} {
+			os.Args = append([]string{"cero-test", mode}, tt.args...)
+			flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+			output := captureOutput(main)
+			expected := tt.verbose
+			if mode == "-json" {
+				expected = tt.jsonPart
+			}
+			if strings.HasPrefix(expected, "!") {
+				assert.NotContains(t, output, expected[1:], tt.args)
+			} else {
+				assert.Contains(t, output, expected, tt.args)
+			}
+		}
+	}
+}
+
+func Test_main_format(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		Issuer:   pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"www.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-format", `{{.Addr}} {{join .Names ","}} {{.Issuer}} {{.ErrorClass}}`, tsURL.Host, "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, tsURL.Host+" example.com,www.example.com CN=example.com \n")
+	assert.Contains(t, output, "127.0.0.1:1   refused\n")
+}
+
+func Test_main_quiet(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	for _, args := range [][]string{{"-v", "-q"}, {"-v", "-silent"}, {"-json", "-q"}} {
+		os.Args = append([]string{"cero-test", "-stats"}, append(args, tsURL.Host, "127.0.0.1:1")...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		// errors are not output, but still counted
+		output := captureOutput(main)
+		assert.Contains(t, output, tsURL.Host, args)
+		assert.NotContains(t, output, "127.0.0.1:1", args)
+		assert.Contains(t, output, "1 errors (refused: 1)", args)
+	}
+}
+
+func Test_main_showErrors(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+
+	// names go to stdout (redirected to file), errors go to stderr
+	os.Args = []string{"cero-test", "-show-errors", "-o", outPath, tsURL.Host, "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, "127.0.0.1:1 -- refused: "), output)
+
+	names, err := os.ReadFile(outPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com\n", string(names))
+
+	// errors are dropped by default
+	os.Args = []string{"cero-test", tsURL.Host, "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	assert.Equal(t, "example.com\n", captureOutput(main))
+}
+
+func Test_main_exitStatus(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	exitCode := -1
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = os.Exit }()
+
+	tests := []struct {
+		args     []string
+		expected int // -1 if exit is not called
+	}{
+		{[]string{"-exit-status", tsURL.Host, "127.0.0.1:1"}, -1},
+		{[]string{"-exit-status", "127.0.0.1:1"}, exitFailed},
+		// not enabled
+		{[]string{"127.0.0.1:1"}, -1},
+	}
+	for _, tt := range tests {
+		exitCode = -1
+		os.Args = append([]string{"cero-test"}, tt.args...)
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		captureOutput(main)
+		assert.Equal(t, tt.expected, exitCode, tt.args)
+	}
+}
+
+func Test_main_sort(t *testing.T) {
+	first := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "c.example.com"},
+		DNSNames: []string{"b.example.com", "a.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer first.Close()
+	second := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "b.example.com"},
+		DNSNames: []string{"d.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer second.Close()
+
+	firstURL, _ := url.Parse(first.URL)
+	secondURL, _ := url.Parse(second.URL)
+
+	os.Args = []string{"cero-test", "-sort", "-unique", firstURL.Host, secondURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "a.example.com\nb.example.com\nc.example.com\nd.example.com\n", output)
+}
+
+func Test_main_csv(t *testing.T) {
+	ts := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		Issuer:   pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"www.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	for per, rows := range map[string]int{"name": 2, "host": 1} {
+		os.Args = []string{"cero-test", "-csv", "-csv-per", per, tsURL.Host}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+		records, err := csv.NewReader(strings.NewReader(captureOutput(main))).ReadAll()
+		if assert.NoError(t, err, per) && assert.Len(t, records, 1+rows, per) {
+			assert.Equal(t, csvHeader(per == "host"), records[0])
+			assert.Equal(t, tsURL.Host, records[1][0])
+			assert.Equal(t, "CN=example.com", records[1][4])
+		}
+	}
+}
+
+func Test_main_issuerClass(t *testing.T) {
+	// self-signed
+	ts := newTestServer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: time.Now().Add(time.Hour)})
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-v", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	assert.Contains(t, captureOutput(main), "-- issuer class: internal/self-signed --")
+
+	os.Args = []string{"cero-test", "-json", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	assert.Contains(t, captureOutput(main), `"issuer_class":"internal/self-signed"`)
+
+	for class, output := range map[string]bool{"internal/self-signed": true, "letsencrypt": false} {
+		os.Args = []string{"cero-test", "-issuer-class", class, tsURL.Host}
+		flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+		assert.Equal(t, output, captureOutput(main) != "", class)
+	}
+}
+
+func Test_main_selfSigned(t *testing.T) {
+	self := newTestServer(t, &x509.Certificate{NotAfter: time.Now().Add(time.Hour)})
+	defer self.Close()
+
+	// leaf issued by CA, presented along with self-signed CA
+	ca := newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Example CA"},
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	})
+	caCert, _ := x509.ParseCertificate(ca.Certificate[0])
+	leaf := newTestCertificate(t, &x509.Certificate{NotAfter: time.Now().Add(time.Hour)})
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotAfter:     time.Now().Add(time.Hour),
+	}, caCert, leaf.PrivateKey.(*ecdsa.PrivateKey).Public(), ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf.Certificate = [][]byte{der, caCert.Raw}
+
+	chained := httptest.NewUnstartedServer(http.NotFoundHandler())
+	chained.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+	chained.StartTLS()
+	defer chained.Close()
+
+	selfURL, _ := url.Parse(self.URL)
+	chainedURL, _ := url.Parse(chained.URL)
+
+	os.Args = []string{"cero-test", "-json", selfURL.Host, chainedURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	output := captureOutput(main)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record jsonResult
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record)) && assert.NotNil(t, record.SelfSigned) {
+			assert.Equal(t, record.Addr == selfURL.Host, *record.SelfSigned, record.Addr)
+		}
+	}
+
+	// only self-signed leaf is output
+	os.Args = []string{"cero-test", "-self-signed-only", "-v", selfURL.Host, chainedURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	output = captureOutput(main)
+	assert.Contains(t, output, selfURL.Host+" -- ")
+	assert.Contains(t, output, "-- self-signed")
+	assert.NotContains(t, output, chainedURL.Host)
+}
+
+func Test_main_weakKeys(t *testing.T) {
+	strong := newTestServer(t, &x509.Certificate{NotAfter: time.Now().Add(time.Hour)})
+	defer strong.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak := httptest.NewUnstartedServer(http.NotFoundHandler())
+	weak.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	weak.StartTLS()
+	defer weak.Close()
+
+	strongURL, _ := url.Parse(strong.URL)
+	weakURL, _ := url.Parse(weak.URL)
+
+	// key is reported in verbose and JSON output
+	os.Args = []string{"cero-test", "-v", strongURL.Host, weakURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	output := captureOutput(main)
+	assert.Contains(t, output, "key: ECDSA 256")
+	assert.Contains(t, output, "key: RSA 1024")
+
+	os.Args = []string{"cero-test", "-json", weakURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	output = captureOutput(main)
+	assert.Contains(t, output, `"pubkey_alg":"RSA","pubkey_bits":1024`)
+
+	// only weak key is output
+	os.Args = []string{"cero-test", "-weak-keys", "-v", strongURL.Host, weakURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+	output = captureOutput(main)
+	assert.Contains(t, output, weakURL.Host)
+	assert.NotContains(t, output, strongURL.Host)
+}
+
+func Test_main_inputFiles(t *testing.T) {
+	first := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "first.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer first.Close()
+	second := newTestServer(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "second.example.com"},
+		NotAfter: time.Now().Add(time.Hour),
+	})
+	defer second.Close()
+
+	firstURL, _ := url.Parse(first.URL)
+	secondURL, _ := url.Parse(second.URL)
+
+	dir := t.TempDir()
+	firstFile := filepath.Join(dir, "first.txt")
+	secondFile := filepath.Join(dir, "second.txt")
+	assert.NoError(t, os.WriteFile(firstFile, []byte("# first server\n\n  "+firstURL.Host+"  \n"), 0o644))
+	assert.NoError(t, os.WriteFile(secondFile, []byte("#"+firstURL.Host+"\n"+secondURL.Host+"\n"), 0o644))
+
+	os.Args = []string{"cero-test", "-i", firstFile, "-i", secondFile}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.ElementsMatch(t, []string{"first.example.com", "second.example.com"}, strings.Fields(output))
+}
+
+func Test_parseSource(t *testing.T) {
+	addr, err := parseSource("127.0.0.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "127.0.0.1:0", addr.String())
+	}
+
+	// not an IP, or not assigned to this host
+	for _, source := range []string{"localhost", "127.0.0.1:8080", "192.0.2.1", "fe80::1%no-such-interface"} {
+		_, err := parseSource(source)
+		assert.Error(t, err, source)
+	}
+
+	// link-local IPv6 address with zone, if host has one
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				source := ipnet.IP.String() + "%" + iface.Name
+				addr, err := parseSource(source)
+				if assert.NoError(t, err, source) {
+					assert.Equal(t, iface.Name, addr.Zone)
+				}
+				return
+			}
+		}
+	}
+}
+
+func Test_stripComment(t *testing.T) {
+	cases := []struct {
+		line, expected string
+	}{
+		{"example.com", "example.com"},
+		{"  example.com  ", "example.com"},
+		{"# comment", ""},
+		{"  #example.com", ""},
+		{"example.com # production", "example.com"},
+		{"example.com\t#production", "example.com"},
+		{"10.0.0.0/24 # office # 2nd floor", "10.0.0.0/24"},
+		{"example.com#fragment", "example.com#fragment"}, // not preceded by whitespace
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, stripComment(c.line), c.line)
+	}
+}
+
+func Test_sendLines(t *testing.T) {
+	input := strings.NewReader("# targets\nexample.com # main site\n\n   # nothing here\n10.0.0.1:8443\n")
+
+	items := make(chan *inputItem)
+	count := uint64(1)
+	go func() {
+		sendLines(context.Background(), items, &count, input)
+		close(items)
+	}()
+
+	// items are numbered after those sent before
+	var got []inputItem
+	for item := range items {
+		got = append(got, *item)
+	}
+	assert.Equal(t, []inputItem{{2, "example.com"}, {3, "10.0.0.1:8443"}}, got)
+	assert.EqualValues(t, 3, count)
+}
+
+func Test_main_noCertificates(t *testing.T) {
+	// server configured with private key, but without certificates
+	cert := newTestCertificate(t, &x509.Certificate{NotAfter: time.Now().Add(time.Hour)})
+	cert.Certificate = nil
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// must not panic, error is reported as any other
+	os.Args = []string{"cero-test", "-v", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, ln.Addr().String()+" -- "), output)
+}
+
+func Test_verifyReason(t *testing.T) {
+	cert := &x509.Certificate{NotBefore: time.Now().Add(time.Hour)}
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, "valid"},
+		{x509.UnknownAuthorityError{}, "untrusted root"},
+		{fmt.Errorf("%w: %w", errSelfSigned, x509.UnknownAuthorityError{}), "self-signed"},
+		{x509.HostnameError{Host: "example.com"}, "hostname mismatch"},
+		{x509.CertificateInvalidError{Reason: x509.Expired}, "expired"},
+		{x509.CertificateInvalidError{Cert: cert, Reason: x509.Expired}, "not yet valid"},
+		{x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}, "not authorized to sign"},
+		{fmt.Errorf("wrapped: %w", x509.UnknownAuthorityError{}), "untrusted root"},
+		{io.EOF, "other"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, verifyReason(c.err))
+	}
+}
+
+// helper utility to generate self-signed certificate from template
+func newTestCertificate(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// helper utility to start TLS server with self-signed certificate, generated from template
+func newTestServer(t *testing.T, template *x509.Certificate) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, template)},
+	}
+	ts.StartTLS()
+	return ts
 }
 
 // helper utility to grab stdout, stderr
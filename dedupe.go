@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// atomic targets already fed within the run (with -dedupe-targets).
+// IPv4 targets are kept compactly, as bitmaps of 65536 IPs (/16 network) per port, the rest are kept as strings
+type targetSet struct {
+	mu      sync.Mutex
+	bitmaps map[uint64]*[1 << 16 / 64]uint64 // /16 network and port -> bit of every IP
+	others  map[string]struct{}
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{bitmaps: make(map[uint64]*[1 << 16 / 64]uint64), others: make(map[string]struct{})}
+}
+
+// adds target to the set, reports whether it was not there before.
+// targets are the same, if they dial the same address with the same SNI (or domain name, it's resolved from)
+func (s *targetSet) add(target *procTarget) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, bit, ok := ipv4TargetBit(target); ok {
+		bitmap, ok := s.bitmaps[key]
+		if !ok {
+			bitmap = new([1 << 16 / 64]uint64)
+			s.bitmaps[key] = bitmap
+		}
+		word, mask := &bitmap[bit/64], uint64(1)<<(bit%64)
+		if *word&mask != 0 {
+			return false
+		}
+		*word |= mask
+		return true
+	}
+
+	key := target.addr + " " + target.serverName + "@" + target.sni
+	if _, ok := s.others[key]; ok {
+		return false
+	}
+	s.others[key] = struct{}{}
+	return true
+}
+
+// returns key of bitmap (/16 network and port) and bit of IPv4 target in it.
+// reports false for other targets (domain names, IPv6, targets with SNI)
+func ipv4TargetBit(target *procTarget) (key uint64, bit uint32, ok bool) {
+	if target.serverName != "" || target.sni != "" {
+		return 0, 0, false
+	}
+	host, port, err := net.SplitHostPort(target.addr)
+	if err != nil {
+		return 0, 0, false
+	}
+	ip := net.ParseIP(host).To4()
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return 0, 0, false
+	}
+	n := binary.BigEndian.Uint32(ip)
+	return uint64(n>>16)<<16 | portNumber, n & 0xFFFF, true
+}
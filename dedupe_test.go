@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_targetSet(t *testing.T) {
+	set := newTargetSet()
+
+	targets := []struct {
+		target *procTarget
+		added  bool
+	}{
+		{&procTarget{addr: "10.0.0.1:443"}, true},
+		{&procTarget{addr: "10.0.0.1:443"}, false},
+		{&procTarget{addr: "10.0.0.1:8443"}, true},
+		{&procTarget{addr: "10.0.0.2:443"}, true},
+		{&procTarget{addr: "10.1.0.1:443"}, true},
+		{&procTarget{addr: "[::ffff:10.0.0.2]:443"}, false}, // the same IPv4
+		{&procTarget{addr: "10.0.0.1:443", serverName: "example.com"}, true},
+		{&procTarget{addr: "10.0.0.1:443", serverName: "example.com"}, false},
+		{&procTarget{addr: "[2001:db8::1]:443"}, true},
+		{&procTarget{addr: "[2001:db8::1]:443"}, false},
+		{&procTarget{addr: "example.com:443"}, true},
+		{&procTarget{addr: "example.com:443"}, false},
+	}
+	for _, tt := range targets {
+		assert.Equal(t, tt.added, set.add(tt.target), tt.target)
+	}
+
+	// IPv4 targets are kept in bitmaps: one per /16 network and port
+	assert.Len(t, set.bitmaps, 3)
+}
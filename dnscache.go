@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long names, that do not exist, are remembered as such
+var negativeDNSTTL = 30 * time.Second
+
+// cache of DNS lookups within the run, keyed by host name.
+// concurrent lookups of the same name wait for the first one
+type dnsCache struct {
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+	entries sync.Map // host name -> *dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	ready   chan struct{} // closed when lookup is done
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time // zero for entry, that never expires
+}
+
+func newDNSCache(lookup func(ctx context.Context, host string) ([]net.IPAddr, error)) *dnsCache {
+	return &dnsCache{lookup: lookup}
+}
+
+// resolves host to its IPs, looking it up only once per run.
+// names, that do not exist, are looked up again after negativeDNSTTL. failures of other kinds are not cached
+func (c *dnsCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	for {
+		entry := &dnsCacheEntry{ready: make(chan struct{})}
+		cached, loaded := c.entries.LoadOrStore(host, entry)
+		if !loaded {
+			return c.resolve(ctx, host, entry)
+		}
+
+		entry = cached.(*dnsCacheEntry)
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			return entry.addrs, entry.err
+		}
+		c.entries.CompareAndDelete(host, entry)
+	}
+}
+
+// looks host up, filling entry already stored in cache
+func (c *dnsCache) resolve(ctx context.Context, host string, entry *dnsCacheEntry) ([]net.IPAddr, error) {
+	defer close(entry.ready)
+
+	entry.addrs, entry.err = c.lookup(ctx, host)
+
+	var dnsErr *net.DNSError
+	switch {
+	case entry.err == nil:
+	case errors.As(entry.err, &dnsErr) && dnsErr.IsNotFound:
+		entry.expires = time.Now().Add(negativeDNSTTL)
+	default:
+		// transient failure: next lookup tries again (ones waiting for this one get its failure)
+		c.entries.Delete(host)
+	}
+	return entry.addrs, entry.err
+}
+
+// cache of reverse lookups (PTR records) of IPs within the run.
+// concurrent lookups of the same IP wait for the first one
+type ptrCache struct {
+	lookup  func(ctx context.Context, addr string) ([]string, error)
+	entries sync.Map // IP -> *ptrCacheEntry
+}
+
+type ptrCacheEntry struct {
+	ready chan struct{} // closed when lookup is done
+	names []string
+}
+
+func newPTRCache(lookup func(ctx context.Context, addr string) ([]string, error)) *ptrCache {
+	return &ptrCache{lookup: lookup}
+}
+
+// returns names of IP (without trailing dots), looking it up only once per run.
+// failure of lookup is not reported: IP just has no names. only definite answers (names, or no such host) are cached
+func (c *ptrCache) LookupAddr(ctx context.Context, ip string) []string {
+	entry := &ptrCacheEntry{ready: make(chan struct{})}
+	cached, loaded := c.entries.LoadOrStore(ip, entry)
+	if !loaded {
+		defer close(entry.ready)
+		names, err := c.lookup(ctx, ip)
+		for _, name := range names {
+			entry.names = append(entry.names, strings.TrimSuffix(name, "."))
+		}
+
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			// transient failure (or cancelled lookup): next lookup tries again
+			c.entries.CompareAndDelete(ip, entry)
+		}
+		return entry.names
+	}
+
+	entry = cached.(*ptrCacheEntry)
+	select {
+	case <-entry.ready:
+		return entry.names
+	case <-ctx.Done():
+		return nil
+	}
+}
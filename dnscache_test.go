@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dnsCache(t *testing.T) {
+	var lookups int32
+	cache := newDNSCache(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		atomic.AddInt32(&lookups, 1)
+		time.Sleep(10 * time.Millisecond)
+		switch host {
+		case "example.com":
+			return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+		case "timeout.example.com":
+			return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	})
+
+	// concurrent lookups of the same name are done once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := cache.LookupIPAddr(context.Background(), "example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, addrs)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&lookups))
+
+	// names, that do not exist, are cached for a while
+	negativeDNSTTL = 50 * time.Millisecond
+	defer func() { negativeDNSTTL = 30 * time.Second }()
+
+	atomic.StoreInt32(&lookups, 0)
+	for i := 0; i < 3; i++ {
+		_, err := cache.LookupIPAddr(context.Background(), "unknown.example.com")
+		var dnsErr *net.DNSError
+		assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&lookups))
+
+	time.Sleep(negativeDNSTTL)
+	_, err := cache.LookupIPAddr(context.Background(), "unknown.example.com")
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&lookups))
+
+	// transient failures are not cached
+	atomic.StoreInt32(&lookups, 0)
+	for i := 0; i < 3; i++ {
+		_, err := cache.LookupIPAddr(context.Background(), "timeout.example.com")
+		assert.Error(t, err)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&lookups))
+
+	// waiting for lookup in progress is cancelled with context
+	done := make(chan struct{})
+	go func() {
+		cache.LookupIPAddr(context.Background(), "other.example.com")
+		close(done)
+	}()
+	time.Sleep(time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cache.LookupIPAddr(ctx, "other.example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	<-done
+}
+
+func Test_ptrCache(t *testing.T) {
+	var lookups int32
+	cache := newPTRCache(func(ctx context.Context, addr string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		time.Sleep(10 * time.Millisecond)
+		switch addr {
+		case "127.0.0.1":
+			return []string{"localhost.", "localhost.localdomain."}, nil
+		case "192.0.2.2":
+			return nil, &net.DNSError{Err: "server misbehaving", Name: addr, IsTemporary: true}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	})
+
+	// concurrent lookups of the same IP are done once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, []string{"localhost", "localhost.localdomain"}, cache.LookupAddr(context.Background(), "127.0.0.1"))
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&lookups))
+
+	// IP without names is cached as such
+	for i := 0; i < 3; i++ {
+		assert.Empty(t, cache.LookupAddr(context.Background(), "192.0.2.1"))
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&lookups))
+
+	// transient failures are not cached
+	for i := 0; i < 3; i++ {
+		assert.Empty(t, cache.LookupAddr(context.Background(), "192.0.2.2"))
+	}
+	assert.EqualValues(t, 5, atomic.LoadInt32(&lookups))
+
+	// neither is lookup, cancelled by its caller
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, cache.LookupAddr(ctx, "192.0.2.3"))
+	assert.Empty(t, cache.LookupAddr(context.Background(), "192.0.2.3"))
+	assert.EqualValues(t, 7, atomic.LoadInt32(&lookups))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// attempts to grab certificate of target, while file descriptors are exhausted
+const fdAttempts = 8
+
+// delay before the first retry of target, that failed because of exhausted file descriptors (doubled for every next one)
+var fdBackoff = 100 * time.Millisecond
+
+// upper bound of concurrency level, chosen automatically
+const maxAutoConcurrency = 1000
+
+// reports whether err is caused by exhausted file descriptors (of process or of the whole system)
+func isFDExhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// returns concurrency level, safe for limit of open file descriptors: half of it
+// (the rest is left for DNS lookups, output and input files), at most maxAutoConcurrency.
+// if limit can not be determined, default level is used
+func autoConcurrency(defaultLevel int) int {
+	limit, ok := fdLimit()
+	if !ok {
+		return defaultLevel
+	}
+	switch level := limit / 2; {
+	case level < 1:
+		return 1
+	case level > maxAutoConcurrency:
+		return maxAutoConcurrency
+	default:
+		return int(level)
+	}
+}
+
+// slots of concurrent connections: semaphore with a slot for every worker.
+// when file descriptors are exhausted, slots are retired one by one, lowering effective concurrency
+type connSlots struct {
+	slots chan struct{}
+	limit int64 // slots not retired
+}
+
+func newConnSlots(n int) *connSlots {
+	s := &connSlots{slots: make(chan struct{}, n), limit: int64(n)}
+	for i := 0; i < n; i++ {
+		s.slots <- struct{}{}
+	}
+	return s
+}
+
+// takes a slot, unless ctx is cancelled first. reports whether slot was taken
+func (s *connSlots) acquire(ctx context.Context) bool {
+	select {
+	case <-s.slots:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *connSlots) release() {
+	s.slots <- struct{}{}
+}
+
+// retires slot taken (it is never released), unless it's the last one. returns number of slots left
+func (s *connSlots) retire() int64 {
+	for {
+		limit := atomic.LoadInt64(&s.limit)
+		if limit <= 1 {
+			s.release()
+			return limit
+		}
+		if atomic.CompareAndSwapInt64(&s.limit, limit, limit-1) {
+			return limit - 1
+		}
+	}
+}
+
+// processes target in a slot of connection, already taken (slot is released when done).
+// if file descriptors are exhausted, lowers concurrency and retries with backoff, instead of reporting failure right away
+func processTargetThrottled(ctx context.Context, slots *connSlots, target *procTarget) *procResult {
+	delay := fdBackoff
+	for attempt := 1; ; attempt++ {
+		result := processTarget(ctx, target)
+		if !isFDExhausted(result.err) || attempt == fdAttempts {
+			slots.release()
+			return result
+		}
+
+		if left := slots.retire(); verbose {
+			fmt.Fprintf(os.Stderr, "%s -- too many open files, concurrency lowered to %d, retrying in %s\n", target.addr, left, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		delay *= 2
+
+		if !slots.acquire(ctx) {
+			return cancelledResult(ctx, target)
+		}
+	}
+}
+
+// processes target, and then its next ports on the same host (with -first-port), until one of them yields certificate.
+// result of the last port tried is returned
+func processHostPorts(ctx context.Context, slots *connSlots, target *procTarget) *procResult {
+	result := processTargetThrottled(ctx, slots, target)
+	if len(target.nextPorts) == 0 {
+		return result
+	}
+
+	host, _, _ := net.SplitHostPort(target.addr)
+	for _, port := range target.nextPorts {
+		if result.err == nil || errors.Is(result.err, context.Canceled) {
+			break
+		}
+		next := *target
+		next.addr, next.nextPorts = net.JoinHostPort(host, port), nil
+		if !slots.acquire(ctx) {
+			return cancelledResult(ctx, &next)
+		}
+		result = processTargetThrottled(ctx, slots, &next)
+	}
+	return result
+}
+
+// result of target, that was not processed because ctx was cancelled
+func cancelledResult(ctx context.Context, target *procTarget) *procResult {
+	return &procResult{id: target.id, addr: target.addr, hostPorts: target.hostPorts, depth: target.depth, ts: time.Now(), err: ctx.Err()}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// limit of open file descriptors is not known on this platform
+func fdLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_processTargetThrottled(t *testing.T) {
+	fdBackoff = time.Millisecond
+	defer func() { fdBackoff = 100 * time.Millisecond }()
+
+	// the first attempts fail, as file descriptors are exhausted
+	var calls int
+	grabCert = func(ctx context.Context, addr string, opts *cero.Options) (*cero.Result, error) {
+		calls++
+		if calls <= 3 {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)}
+		}
+		return &cero.Result{Names: []string{"example.com"}}, nil
+	}
+	defer func() { grabCert = cero.GrabCert }()
+
+	slots := newConnSlots(3)
+	slots.acquire(context.Background())
+	result := processTargetThrottled(context.Background(), slots, &procTarget{addr: "127.0.0.1:443"})
+	assert.NoError(t, result.err)
+	assert.Equal(t, []string{"example.com"}, result.names)
+	assert.Equal(t, 4, calls)
+
+	// concurrency is lowered, but never below one slot
+	assert.EqualValues(t, 1, slots.limit)
+	assert.Len(t, slots.slots, 1)
+
+	// failure is reported, when attempts are over
+	calls = -100
+	slots.acquire(context.Background())
+	result = processTargetThrottled(context.Background(), slots, &procTarget{addr: "127.0.0.1:443"})
+	assert.True(t, isFDExhausted(result.err))
+	assert.Equal(t, -100+fdAttempts, calls)
+	assert.Len(t, slots.slots, 1)
+}
+
+func Test_autoConcurrency(t *testing.T) {
+	level := autoConcurrency(100)
+	assert.GreaterOrEqual(t, level, 1)
+	assert.LessOrEqual(t, level, maxAutoConcurrency)
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// returns limit of open file descriptors of the process
+func fdLimit() (uint64, bool) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, false
+	}
+	return uint64(rlimit.Cur), true
+}
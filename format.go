@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+)
+
+// result, as seen by output template (see -format)
+type templateResult struct {
+	ID            uint64 // number of input item, the result originates from
+	Addr          string
+	Host          string
+	Port          int
+	Names         []string
+	Error         string // empty on success
+	ErrorClass    string
+	TS            time.Time
+	NotBefore     time.Time
+	NotAfter      time.Time
+	Issuer        string // 'CN=name, O=organization'
+	IssuerCN      string
+	IssuerOrg     []string
+	IssuerClass   string
+	SHA256        string
+	TLSVersion    string
+	CipherSuite   string
+	ALPN          string
+	RemoteAddr    string
+	Hostname      string
+	HostnameMatch bool
+	PubKeyAlg     string
+	PubKeyBits    int
+	SelfSigned    bool
+	Verify        string // only with -verify
+	ASN           uint32
+	ASOrg         string
+	PTR           []string
+	SNI           string // only with -sni-pool
+}
+
+// functions available to output template, in addition to builtin ones
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// compiles output template, set with -format (nil if not set). exits on parse error
+func compileFormat(format string) *template.Template {
+	if format == "" {
+		return nil
+	}
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -format: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	return tmpl
+}
+
+func newTemplateResult(result *procResult) *templateResult {
+	record := &templateResult{
+		ID:    result.id,
+		Addr:  result.addr,
+		Port:  resultPort(result),
+		Names: result.names,
+		TS:    result.ts,
+		ASN:   result.asn,
+		ASOrg: result.asOrg,
+		PTR:   result.ptr,
+		SNI:   result.sni,
+	}
+
+	// address of failed input item might not be splittable
+	var err error
+	if record.Host, _, err = net.SplitHostPort(result.addr); err != nil {
+		record.Host = result.addr
+	}
+
+	if result.err != nil {
+		record.Error = result.err.Error()
+		record.ErrorClass = cero.ClassifyError(result.err)
+		return record
+	}
+
+	record.NotBefore, record.NotAfter = result.notBefore, result.notAfter
+	record.Issuer, record.IssuerCN, record.IssuerOrg = issuerString(result), result.issuerCN, result.issuerOrg
+	record.IssuerClass = result.issuerClass
+	record.SHA256 = result.sha256
+	record.TLSVersion, record.CipherSuite = cero.TLSVersionName(result.version), tls.CipherSuiteName(result.cipher)
+	record.ALPN = result.alpn
+	record.RemoteAddr = result.remote
+	record.Hostname, record.HostnameMatch = result.hostname, result.hostMatch
+	record.PubKeyAlg, record.PubKeyBits = result.pubKeyAlg.String(), result.pubKeyBits
+	record.SelfSigned = result.selfSigned
+	if verify {
+		record.Verify = verifyReason(result.verifyErr)
+	}
+	return record
+}
+
+// applies output template to result, terminating output with newline.
+// empty output is not written at all, so that template can skip results
+func writeTemplate(w io.Writer, tmpl *template.Template, result *procResult) error {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, newTemplateResult(result)); err != nil {
+		return err
+	}
+	line := b.String()
+	if line == "" {
+		return nil
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+// header of CSV output: one row for every name, or for every address with all of its names (space-separated)
+func csvHeader(perHost bool) []string {
+	if perHost {
+		return []string{"addr", "host", "port", "names", "issuer", "not_after", "error"}
+	}
+	return []string{"addr", "host", "port", "name", "issuer", "not_after", "error"}
+}
+
+// writes CSV rows of result (see csvHeader). failed result gets single row with its error
+func writeCSV(w *csv.Writer, result *procResult, perHost bool) error {
+	record := newTemplateResult(result)
+	row := func(names string) []string {
+		var notAfter string
+		if record.Error == "" {
+			notAfter = record.NotAfter.UTC().Format(time.RFC3339)
+		}
+		return []string{record.Addr, record.Host, strconv.Itoa(record.Port), names, record.Issuer, notAfter, record.Error}
+	}
+
+	if perHost || record.Error != "" {
+		return w.Write(row(strings.Join(record.Names, " ")))
+	}
+	for _, name := range record.Names {
+		if err := w.Write(row(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_writeTemplate(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		format   string
+		result   *procResult
+		expected string
+	}{
+		{
+			`{{.Addr}} {{.Host}} {{.Port}} {{range .Names}}{{.}} {{end}}{{.Issuer}} {{.NotAfter.Format "2006-01-02"}}`,
+			&procResult{addr: "10.0.0.1:443", names: []string{"example.com", "www.example.com"}, issuerCN: "Example CA", notAfter: notAfter},
+			"10.0.0.1:443 10.0.0.1 443 example.com www.example.com CN=Example CA 2030-01-02\n",
+		},
+		{
+			`{{join .Names ","}}{{if .SelfSigned}} self-signed{{end}}`,
+			&procResult{addr: "example.com:443", names: []string{"example.com", "www.example.com"}, selfSigned: true},
+			"example.com,www.example.com self-signed\n",
+		},
+		{
+			// errors are passed to template too, output already terminated is not terminated again
+			"{{.Addr}} {{.ErrorClass}}\n",
+			&procResult{addr: "10.0.0.1:443", err: syscall.ECONNREFUSED},
+			"10.0.0.1:443 refused\n",
+		},
+		{
+			`{{.Host}} {{.Error}}`,
+			&procResult{addr: "bad input", err: errors.New("invalid port")},
+			"bad input invalid port\n",
+		},
+		{
+			// results skipped by template produce no line
+			`{{if not .Error}}{{.Addr}}{{end}}`,
+			&procResult{addr: "10.0.0.1:443", err: syscall.ECONNREFUSED},
+			"",
+		},
+	}
+
+	for _, c := range cases {
+		var b strings.Builder
+		if assert.NoError(t, writeTemplate(&b, compileFormat(c.format), c.result), c.format) {
+			assert.Equal(t, c.expected, b.String(), c.format)
+		}
+	}
+
+	// unknown fields fail at execution
+	var b strings.Builder
+	assert.Error(t, writeTemplate(&b, compileFormat("{{.Unknown}}"), &procResult{addr: "10.0.0.1:443"}))
+}
+
+func Test_writeCSV(t *testing.T) {
+	notAfter := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	result := &procResult{addr: "10.0.0.1:443", names: []string{"example.com", "www.example.com"}, issuerCN: "Example CA", issuerOrg: []string{"Example, Inc."}, notAfter: notAfter}
+	failed := &procResult{addr: "10.0.0.2:443", err: syscall.ECONNREFUSED}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(csvHeader(false))
+	assert.NoError(t, writeCSV(w, result, false))
+	assert.NoError(t, writeCSV(w, failed, false))
+	w.Flush()
+	assert.Equal(t, ""+
+		"addr,host,port,name,issuer,not_after,error\n"+
+		"10.0.0.1:443,10.0.0.1,443,example.com,\"CN=Example CA, O=Example, Inc.\",2030-01-02T00:00:00Z,\n"+
+		"10.0.0.1:443,10.0.0.1,443,www.example.com,\"CN=Example CA, O=Example, Inc.\",2030-01-02T00:00:00Z,\n"+
+		"10.0.0.2:443,10.0.0.2,443,,,,connection refused\n",
+		b.String())
+
+	b.Reset()
+	w = csv.NewWriter(&b)
+	w.Write(csvHeader(true))
+	assert.NoError(t, writeCSV(w, result, true))
+	w.Flush()
+	assert.Equal(t, ""+
+		"addr,host,port,names,issuer,not_after,error\n"+
+		"10.0.0.1:443,10.0.0.1,443,example.com www.example.com,\"CN=Example CA, O=Example, Inc.\",2030-01-02T00:00:00Z,\n",
+		b.String())
+}
@@ -2,10 +2,24 @@ module github.com/glebarez/cero
 
 go 1.20
 
-require github.com/stretchr/testify v1.8.3
+require (
+	github.com/quic-go/quic-go v0.37.4
+	github.com/refraction-networking/utls v1.5.4
+	github.com/stretchr/testify v1.8.3
+	golang.org/x/net v0.14.0
+	golang.org/x/time v0.3.0
+)
 
 require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/cloudflare/circl v1.3.3 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gaukas/godicttls v0.0.4 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.12.0 // indirect
+	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
+	golang.org/x/sys v0.11.0 // indirect
+	golang.org/x/text v0.12.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// coarse classes of certificate issuers
+const (
+	issuerClassSelfSigned = "internal/self-signed"
+	issuerClassOther      = "other"
+)
+
+// class of issuers: issuer belongs to it, if its CommonName or Organization contains one of patterns (case-insensitive)
+type issuerClass struct {
+	label    string
+	patterns []string
+}
+
+// built-in table of well-known issuers (replaced with -issuer-classes)
+var defaultIssuerClasses = []issuerClass{
+	{"letsencrypt", []string{"let's encrypt", "isrg"}},
+	{"digicert", []string{"digicert", "geotrust", "thawte", "rapidssl"}},
+	{"cloudflare", []string{"cloudflare"}},
+	{"amazon", []string{"amazon"}},
+	{"google", []string{"google trust services"}},
+	{"sectigo", []string{"sectigo", "comodo"}},
+}
+
+// table of issuers to classify certificates with
+var issuerClasses = defaultIssuerClasses
+
+// returns labels of classes of table, along with the built-in ones
+func issuerClassLabels(table []issuerClass) []string {
+	var labels []string
+	for _, class := range table {
+		labels = append(labels, class.label)
+	}
+	return append(labels, issuerClassSelfSigned, issuerClassOther)
+}
+
+// reports whether label is one of issuer classes in use (case-insensitive)
+func isIssuerClass(label string) bool {
+	for _, known := range issuerClassLabels(issuerClasses) {
+		if strings.EqualFold(label, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns class of issuer of result: the first one of table, that matches it.
+// self-signed certificates are classed as internal, the rest as other
+func classifyIssuer(table []issuerClass, result *procResult) string {
+	if result.selfSigned {
+		return issuerClassSelfSigned
+	}
+	for _, class := range table {
+		for _, pattern := range class.patterns {
+			if issuerContains(result, pattern) {
+				return class.label
+			}
+		}
+	}
+	return issuerClassOther
+}
+
+// loads table of issuers from file: 'label: pattern, pattern...' at every line.
+// empty lines and comments (lines starting with #) are skipped
+func loadIssuerClasses(path string) ([]issuerClass, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var table []issuerClass
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		label, patterns, found := strings.Cut(text, ":")
+		class := issuerClass{label: strings.TrimSpace(label)}
+		for _, pattern := range strings.Split(patterns, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				class.patterns = append(class.patterns, pattern)
+			}
+		}
+		if !found || class.label == "" || len(class.patterns) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected 'label: pattern, pattern...'", path, line)
+		}
+		table = append(table, class)
+	}
+	return table, sc.Err()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_classifyIssuer(t *testing.T) {
+	cases := []struct {
+		result   *procResult
+		expected string
+	}{
+		{&procResult{issuerCN: "R3", issuerOrg: []string{"Let's Encrypt"}}, "letsencrypt"},
+		{&procResult{issuerCN: "DigiCert TLS RSA SHA256 2020 CA1", issuerOrg: []string{"DigiCert Inc"}}, "digicert"},
+		{&procResult{issuerCN: "Cloudflare Inc ECC CA-3"}, "cloudflare"},
+		{&procResult{issuerCN: "Amazon RSA 2048 M01", issuerOrg: []string{"Amazon"}}, "amazon"},
+		{&procResult{issuerCN: "Corp Issuing CA", issuerOrg: []string{"Example Corp"}}, "other"},
+		{&procResult{issuerCN: "example.com", selfSigned: true}, "internal/self-signed"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, classifyIssuer(defaultIssuerClasses, c.result), c.result.issuerCN)
+	}
+}
+
+func Test_loadIssuerClasses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "classes.txt")
+	data := "# internal CAs first\ncorp: Example Corp, Corp Issuing\n\nletsencrypt: Let's Encrypt\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := loadIssuerClasses(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []issuerClass{
+			{"corp", []string{"Example Corp", "Corp Issuing"}},
+			{"letsencrypt", []string{"Let's Encrypt"}},
+		}, table)
+		assert.Equal(t, "corp", classifyIssuer(table, &procResult{issuerCN: "Corp Issuing CA"}))
+		assert.Equal(t, "other", classifyIssuer(table, &procResult{issuerCN: "Amazon RSA 2048 M01"}))
+	}
+
+	for _, data := range []string{"corp\n", "corp:\n", ": Example Corp\n"} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadIssuerClasses(path)
+		assert.Error(t, err, data)
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+)
+
+// formats successful result for verbose output
+func verboseLine(result *procResult) string {
+	parts := []string{result.addr}
+	if showIDs {
+		parts = append(parts, fmt.Sprintf("id: %d", result.id))
+	}
+	if showAddr {
+		parts = append(parts, "remote: "+result.remote)
+	}
+	parts = append(parts,
+		fmt.Sprint(result.names),
+		fmt.Sprintf("valid %s to %s", result.notBefore.UTC().Format(time.RFC3339), result.notAfter.UTC().Format(time.RFC3339)),
+		"issuer: "+issuerString(result),
+		"issuer class: "+result.issuerClass,
+		"sha256: "+result.sha256,
+		fmt.Sprintf("tls: %s, %s", cero.TLSVersionName(result.version), tls.CipherSuiteName(result.cipher)),
+		"key: "+publicKeyString(result),
+	)
+	if len(options.ALPN) > 0 {
+		parts = append(parts, "alpn: "+alpnString(result.alpn))
+	}
+	if result.sni != "" {
+		parts = append(parts, "sni: "+result.sni)
+	}
+	if result.hostname != "" && !result.hostMatch {
+		parts = append(parts, "hostname mismatch: "+result.hostname)
+	}
+	if result.selfSigned {
+		parts = append(parts, "self-signed")
+	}
+	for i, cert := range result.chain {
+		parts = append(parts, fmt.Sprintf("#%d %s (issuer: %s): %v", i, cert.subject, cert.issuer, cert.names))
+	}
+	if asnDatabase != nil {
+		if result.asn != 0 {
+			parts = append(parts, fmt.Sprintf("AS%d %s", result.asn, result.asOrg))
+		} else {
+			parts = append(parts, "AS unknown")
+		}
+	}
+	if ptrLookups != nil {
+		parts = append(parts, "ptr: "+strings.Join(result.ptr, ", "))
+	}
+	if expiredOnly {
+		parts = append(parts, fmt.Sprintf("expired %s ago", time.Since(result.notAfter).Truncate(time.Second)))
+	}
+	if verify {
+		parts = append(parts, "verify: "+verifyReason(result.verifyErr))
+	}
+	return strings.Join(parts, " -- ")
+}
+
+// JSON record of result
+type jsonResult struct {
+	Addr        string           `json:"addr"`
+	Host        string           `json:"host"`
+	Port        int              `json:"port"`
+	Names       []string         `json:"names"`
+	Error       *string          `json:"error"`
+	ErrClass    string           `json:"error_class,omitempty"`
+	TS          string           `json:"ts"`
+	NotBefore   string           `json:"not_before,omitempty"`
+	NotAfter    string           `json:"not_after,omitempty"`
+	IssuerCN    string           `json:"issuer_cn,omitempty"`
+	IssuerOrg   []string         `json:"issuer_org,omitempty"`
+	IssuerClass string           `json:"issuer_class,omitempty"`
+	SHA256      string           `json:"fingerprint_sha256,omitempty"`
+	Version     string           `json:"tls_version,omitempty"`
+	Cipher      string           `json:"cipher_suite,omitempty"`
+	ALPN        string           `json:"alpn,omitempty"`
+	Remote      string           `json:"remote_addr,omitempty"`
+	HostMatch   *bool            `json:"hostname_match,omitempty"` // only for domain names
+	PubKeyAlg   string           `json:"pubkey_alg,omitempty"`
+	PubKeyBits  int              `json:"pubkey_bits,omitempty"`
+	SelfSigned  *bool            `json:"self_signed,omitempty"` // only for certificates grabbed
+	Chain       []*jsonChainCert `json:"chain,omitempty"`
+	Cert        *jsonCert        `json:"cert,omitempty"`
+	Verify      string           `json:"verify,omitempty"`
+	ASN         uint32           `json:"asn,omitempty"`
+	ASOrg       string           `json:"as_org,omitempty"`
+	PTR         []string         `json:"ptr,omitempty"`
+	SNI         string           `json:"sni,omitempty"` // only with -sni-pool
+	ID          uint64           `json:"id,omitempty"`  // only with -ids
+}
+
+// JSON record of certificate of the chain
+type jsonChainCert struct {
+	Subject string   `json:"subject"`
+	Issuer  string   `json:"issuer"`
+	Names   []string `json:"names"`
+}
+
+// JSON record of full certificate metadata
+type jsonCert struct {
+	SubjectCN   string   `json:"subject_cn"`
+	SubjectOrg  []string `json:"subject_org"`
+	IssuerCN    string   `json:"issuer_cn"`
+	Serial      string   `json:"serial"` // hexadecimal
+	NotBefore   string   `json:"not_before"`
+	NotAfter    string   `json:"not_after"`
+	DNSNames    []string `json:"dns_names"`
+	IPAddresses []string `json:"ip_addresses"`
+	URIs        []string `json:"uris"`
+	Emails      []string `json:"emails"`
+	SigAlg      string   `json:"sig_alg"`
+	PubKeyAlg   string   `json:"pubkey_alg"`
+	SHA256      string   `json:"fingerprint_sha256"`
+}
+
+func newJSONCert(cert *x509.Certificate) *jsonCert {
+	record := &jsonCert{
+		SubjectCN:  cert.Subject.CommonName,
+		SubjectOrg: cert.Subject.Organization,
+		IssuerCN:   cert.Issuer.CommonName,
+		NotBefore:  cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:   cert.NotAfter.UTC().Format(time.RFC3339),
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+		SigAlg:     cert.SignatureAlgorithm.String(),
+		PubKeyAlg:  cert.PublicKeyAlgorithm.String(),
+	}
+	if cert.SerialNumber != nil {
+		record.Serial = cert.SerialNumber.Text(16)
+	}
+	for _, ip := range cert.IPAddresses {
+		record.IPAddresses = append(record.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		record.URIs = append(record.URIs, uri.String())
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	record.SHA256 = hex.EncodeToString(sum[:])
+	return record
+}
+
+// JSON record of results of all ports of the same host
+type jsonHostGroup struct {
+	Host  string        `json:"host"`
+	Ports []*jsonResult `json:"ports"`
+}
+
+func newJSONResult(result *procResult) *jsonResult {
+	record := &jsonResult{
+		Addr:  result.addr,
+		Port:  resultPort(result),
+		Names: result.names,
+		TS:    result.ts.Format(time.RFC3339),
+		ASN:   result.asn,
+		ASOrg: result.asOrg,
+		PTR:   result.ptr,
+		SNI:   result.sni,
+	}
+	if showIDs {
+		record.ID = result.id
+	}
+
+	// address of failed input item might not be splittable
+	var err error
+	if record.Host, _, err = net.SplitHostPort(result.addr); err != nil {
+		record.Host = result.addr
+	}
+
+	if result.err != nil {
+		errStr := result.err.Error()
+		record.Error = &errStr
+		record.ErrClass = cero.ClassifyError(result.err)
+		return record
+	}
+
+	record.NotBefore = result.notBefore.UTC().Format(time.RFC3339)
+	record.NotAfter = result.notAfter.UTC().Format(time.RFC3339)
+	record.IssuerCN, record.IssuerOrg = result.issuerCN, result.issuerOrg
+	record.IssuerClass = result.issuerClass
+	record.SHA256 = result.sha256
+	record.Version, record.Cipher = cero.TLSVersionName(result.version), tls.CipherSuiteName(result.cipher)
+	record.ALPN = result.alpn
+	record.Cert = result.cert
+	record.PubKeyAlg, record.PubKeyBits = result.pubKeyAlg.String(), result.pubKeyBits
+	record.SelfSigned = &result.selfSigned
+	if result.hostname != "" {
+		record.HostMatch = &result.hostMatch
+	}
+	if showAddr {
+		record.Remote = result.remote
+	}
+	for _, cert := range result.chain {
+		record.Chain = append(record.Chain, &jsonChainCert{Subject: cert.subject, Issuer: cert.issuer, Names: cert.names})
+	}
+
+	if verify {
+		record.Verify = verifyReason(result.verifyErr)
+	}
+	return record
+}
+
+func newJSONHostGroup(results []*procResult) *jsonHostGroup {
+	sortByPort(results)
+
+	host, _, _ := net.SplitHostPort(results[0].addr)
+	record := &jsonHostGroup{Host: host}
+	for _, result := range results {
+		record.Ports = append(record.Ports, newJSONResult(result))
+	}
+	return record
+}
+
+// results of ports of the same host
+type hostGroup struct {
+	results []*procResult // results to output
+	pending int           // number of ports not processed yet
+}
+
+// results of hosts, buffered until all of their ports are processed
+type hostGroups map[string]*hostGroup
+
+// adds processed result to the group of its host (if output is false, result is only counted as processed).
+// when all ports of the host are processed, returns results to output and true
+func (groups hostGroups) add(result *procResult, output bool) ([]*procResult, bool) {
+	host, _, err := net.SplitHostPort(result.addr)
+	if err != nil || result.hostPorts <= 1 {
+		// nothing to wait for
+		if output {
+			return []*procResult{result}, true
+		}
+		return nil, true
+	}
+
+	group, ok := groups[host]
+	if !ok {
+		group = &hostGroup{pending: result.hostPorts}
+		groups[host] = group
+	}
+
+	if output {
+		group.results = append(group.results, result)
+	}
+	group.pending--
+
+	if group.pending > 0 {
+		return nil, false
+	}
+	delete(groups, host)
+	return group.results, true
+}
+
+// formats results of ports of the same host for verbose output
+func hostGroupLine(results []*procResult) string {
+	sortByPort(results)
+
+	host, _, _ := net.SplitHostPort(results[0].addr)
+	line := host
+	for _, result := range results {
+		line += fmt.Sprintf(" -- %d: ", resultPort(result))
+		if result.err != nil {
+			line += errorString(result.err)
+		} else {
+			line += strings.TrimPrefix(verboseLine(result), result.addr+" -- ")
+		}
+	}
+	return line
+}
+
+// orders results of the same host by port number
+func sortByPort(results []*procResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return resultPort(results[i]) < resultPort(results[j])
+	})
+}
+
+// returns numeric port of result address
+func resultPort(result *procResult) int {
+	_, port, _ := net.SplitHostPort(result.addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// formats failed result for verbose output: 'addr -- class: error message'
+func verboseErrorLine(result *procResult) string {
+	parts := []string{result.addr}
+	if showIDs {
+		parts = append(parts, fmt.Sprintf("id: %d", result.id))
+	}
+	return strings.Join(append(parts, errorString(result.err)), " -- ")
+}
+
+// formats error, prefixed with its class: 'class: message'
+func errorString(err error) string {
+	return cero.ClassifyError(err) + ": " + err.Error()
+}
+
+// reports whether result must be filtered out of output
+func isFiltered(result *procResult) bool {
+	if quiet && result.err != nil {
+		return true
+	}
+	if errorsOnly != nil {
+		return result.err == nil || !errorsOnly[cero.ClassifyError(result.err)]
+	}
+	if result.err != nil {
+		return false
+	}
+
+	if expiredOnly && !isExpired(result) {
+		return true
+	}
+	if expiringDays > 0 && result.notAfter.After(time.Now().AddDate(0, 0, expiringDays)) {
+		return true
+	}
+	if issuerFilter != "" && !issuerContains(result, issuerFilter) {
+		return true
+	}
+	if issuerClassOnly != "" && !strings.EqualFold(result.issuerClass, issuerClassOnly) {
+		return true
+	}
+	if weakKeys && !cero.IsWeakKey(result.pubKeyAlg, result.pubKeyBits) {
+		return true
+	}
+	if selfSignedOnly && !result.selfSigned {
+		return true
+	}
+	return false
+}
+
+// formats public key of certificate as 'algorithm bits'
+func publicKeyString(result *procResult) string {
+	if result.pubKeyBits == 0 {
+		return result.pubKeyAlg.String()
+	}
+	return fmt.Sprintf("%s %d", result.pubKeyAlg, result.pubKeyBits)
+}
+
+// formats negotiated application protocol, that might be absent
+func alpnString(proto string) string {
+	if proto == "" {
+		return "none"
+	}
+	return proto
+}
+
+// formats certificate issuer as 'CN=name, O=organization'
+func issuerString(result *procResult) string {
+	return dnString(result.issuerCN, result.issuerOrg)
+}
+
+// formats distinguished name of certificate subject or issuer as 'CN=name, O=organization'
+func dnString(cn string, orgs []string) string {
+	parts := make([]string, 0, len(orgs)+1)
+	if cn != "" {
+		parts = append(parts, "CN="+cn)
+	}
+	for _, org := range orgs {
+		parts = append(parts, "O="+org)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reports whether certificate issuer CommonName or Organization contains substr (case-insensitive)
+func issuerContains(result *procResult, substr string) bool {
+	substr = strings.ToLower(substr)
+	if strings.Contains(strings.ToLower(result.issuerCN), substr) {
+		return true
+	}
+	for _, org := range result.issuerOrg {
+		if strings.Contains(strings.ToLower(org), substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns names of certificate, that pass name filters
+func filterNames(names []string) []string {
+	if len(matchDomains) == 0 && grepNames == nil && grepOutNames == nil {
+		return names
+	}
+
+	filtered := make([]string, 0, len(names))
+	for _, name := range names {
+		switch {
+		case len(matchDomains) > 0 && !matchesDomain(name, matchDomains):
+		case grepNames != nil && !grepNames.MatchString(name):
+		case grepOutNames != nil && grepOutNames.MatchString(name):
+		default:
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// reports whether name is one of domains or their subdomain (domains must be normalized).
+// matching is done on label boundary: evilexample.com does not belong to example.com
+func matchesDomain(name string, domains []string) bool {
+	name = normalizeName(name)
+	for _, domain := range domains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizes name for comparison: lower case, without trailing dot
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// reports whether certificate of successful result has expired
+func isExpired(result *procResult) bool {
+	return result.notAfter.Before(time.Now())
+}
+
+// resource records, grouped by their owner names: every name with all IPs it was found on, every record once
+type rrGroups struct {
+	owners  []string            // owner names, in order of discovery
+	records map[string][]string // owner name -> its records, in order of discovery
+	seen    map[string]struct{}
+}
+
+func newRRGroups() *rrGroups {
+	return &rrGroups{records: make(map[string][]string), seen: make(map[string]struct{})}
+}
+
+// adds records (see resourceRecords) to groups of their owners, skipping ones already added
+func (g *rrGroups) add(records []string) {
+	for _, record := range records {
+		if _, seen := g.seen[record]; seen {
+			continue
+		}
+		g.seen[record] = struct{}{}
+
+		owner, _, _ := strings.Cut(record, " ")
+		if _, ok := g.records[owner]; !ok {
+			g.owners = append(g.owners, owner)
+		}
+		g.records[owner] = append(g.records[owner], record)
+	}
+}
+
+// returns records, grouped by owner names (sorted, if sorted is set)
+func (g *rrGroups) lines(sorted bool) []string {
+	owners := g.owners
+	if sorted {
+		owners = append([]string(nil), owners...)
+		sort.Strings(owners)
+	}
+
+	var lines []string
+	for _, owner := range owners {
+		lines = append(lines, g.records[owner]...)
+	}
+	return lines
+}
+
+// formats successful result as DNS master-file resource records, mapping every name to the IP it was found on.
+// returns nothing if result was not grabbed from a bare IP
+func resourceRecords(result *procResult) []string {
+	host, _, err := net.SplitHostPort(result.addr)
+	if err != nil {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	rrType := "A"
+	if ip.To4() == nil {
+		rrType = "AAAA"
+	}
+
+	records := make([]string, 0, len(result.names))
+	for _, name := range result.names {
+		// skip names that can not be owner of a record
+		if name == "" || net.ParseIP(name) != nil {
+			continue
+		}
+
+		// names in master-file are fully qualified
+		if !strings.HasSuffix(name, ".") {
+			name += "."
+		}
+		records = append(records, fmt.Sprintf("%s IN %s %s", name, rrType, ip))
+	}
+	return records
+}
+
+// replaces characters, that are not safe for file names (IPv6 colons, CIDR slashes, brackets)
+var fileNameReplacer = strings.NewReplacer(":", "_", "/", "_", "\\", "_", "[", "", "]", "")
+
+// writes result into its own file in dir, named after result address.
+// file is written atomically: readers will never see a partially written result
+func writeResultFile(dir string, result *procResult) error {
+	var content string
+	if jsonOutput {
+		record, err := json.Marshal(newJSONResult(result))
+		if err != nil {
+			return err
+		}
+		content = string(record) + "\n"
+	} else if result.err != nil {
+		content = fmt.Sprintf("%s -- %s\n", result.addr, errorString(result.err))
+	} else {
+		content = verboseLine(result) + "\n"
+	}
+
+	tmp, err := os.CreateTemp(dir, ".cero-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, fileNameReplacer.Replace(result.addr)+".txt"))
+}
+
+// writes certificates of successful result into dir as PEM file, named after SHA-256 fingerprint of leaf.
+// certificate already written (e.g. presented by another host) is not written again
+func dumpCertificates(dir string, result *procResult) error {
+	path := filepath.Join(dir, result.sha256+".pem")
+	if _, err := os.Stat(path); err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var content []byte
+	for _, der := range result.certs {
+		content = append(content, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".cero-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resourceRecords(t *testing.T) {
+	cases := []struct {
+		result   *procResult
+		expected []string
+	}{
+		{
+			&procResult{addr: "10.0.0.1:443", names: []string{"example.com", "*.example.com", "", "10.0.0.1"}},
+			[]string{"example.com. IN A 10.0.0.1", "*.example.com. IN A 10.0.0.1"},
+		},
+		{
+			&procResult{addr: "[2001:db8::1]:443", names: []string{"example.com."}},
+			[]string{"example.com. IN AAAA 2001:db8::1"},
+		},
+		{
+			&procResult{addr: "example.com:443", names: []string{"example.com"}},
+			nil,
+		},
+		{
+			&procResult{addr: "10.0.0.1:443", err: errors.New("timeout")},
+			[]string{},
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, resourceRecords(c.result))
+	}
+}
+
+func Test_rrGroups(t *testing.T) {
+	groups := newRRGroups()
+	groups.add([]string{"www.example.com. IN A 10.0.0.1", "example.com. IN A 10.0.0.1"})
+	groups.add([]string{"example.com. IN A 10.0.0.2", "example.com. IN A 10.0.0.1", "a.example.com. IN A 10.0.0.2"})
+	groups.add([]string{"www.example.com. IN AAAA 2001:db8::1"})
+
+	// every name with all of its IPs, names in order of discovery
+	assert.Equal(t, []string{
+		"www.example.com. IN A 10.0.0.1",
+		"www.example.com. IN AAAA 2001:db8::1",
+		"example.com. IN A 10.0.0.1",
+		"example.com. IN A 10.0.0.2",
+		"a.example.com. IN A 10.0.0.2",
+	}, groups.lines(false))
+
+	// sorted by names
+	assert.Equal(t, []string{
+		"a.example.com. IN A 10.0.0.2",
+		"example.com. IN A 10.0.0.1",
+		"example.com. IN A 10.0.0.2",
+		"www.example.com. IN A 10.0.0.1",
+		"www.example.com. IN AAAA 2001:db8::1",
+	}, groups.lines(true))
+
+	assert.Empty(t, newRRGroups().lines(true))
+}
+
+func Test_writeResultFile(t *testing.T) {
+	dir := t.TempDir()
+
+	results := []*procResult{
+		{addr: "10.0.0.1:443", names: []string{"example.com"}},
+		{addr: "[2001:db8::1]:443", err: syscall.ECONNREFUSED},
+	}
+	for _, result := range results {
+		if err := writeResultFile(dir, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "10.0.0.1_443.txt"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "10.0.0.1:443 -- [example.com]"))
+
+	content, err = os.ReadFile(filepath.Join(dir, "2001_db8__1_443.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:443 -- refused: connection refused\n", string(content))
+
+	// no temporary files left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 2)
+}
+
+func Test_dumpCertificates(t *testing.T) {
+	dir := t.TempDir()
+
+	result := &procResult{addr: "10.0.0.1:443", sha256: "abcd", certs: [][]byte{{1, 2, 3}, {4, 5}}}
+	if err := dumpCertificates(dir, result); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "abcd.pem"))
+	assert.NoError(t, err)
+
+	var ders [][]byte
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		assert.Equal(t, "CERTIFICATE", block.Type)
+		ders = append(ders, block.Bytes)
+	}
+	assert.Equal(t, result.certs, ders)
+
+	// file of the same certificate is not written again
+	result.certs = [][]byte{{6}}
+	assert.NoError(t, dumpCertificates(dir, result))
+	again, _ := os.ReadFile(filepath.Join(dir, "abcd.pem"))
+	assert.Equal(t, content, again)
+
+	// no temporary files left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
+
+func Test_newJSONCert(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.com/service")
+	cert := &x509.Certificate{
+		Raw:                []byte{1, 2, 3},
+		SerialNumber:       big.NewInt(0xabcdef),
+		Subject:            pkix.Name{CommonName: "example.com", Organization: []string{"Example"}},
+		Issuer:             pkix.Name{CommonName: "Example CA"},
+		NotBefore:          time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:           []string{"example.com", "www.example.com"},
+		IPAddresses:        []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+		URIs:               []*url.URL{uri},
+		EmailAddresses:     []string{"admin@example.com"},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		PublicKeyAlgorithm: x509.ECDSA,
+	}
+
+	record, err := json.Marshal(newJSONCert(cert))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"subject_cn": "example.com",
+		"subject_org": ["Example"],
+		"issuer_cn": "Example CA",
+		"serial": "abcdef",
+		"not_before": "2023-01-01T00:00:00Z",
+		"not_after": "2024-01-01T00:00:00Z",
+		"dns_names": ["example.com", "www.example.com"],
+		"ip_addresses": ["10.0.0.1", "2001:db8::1"],
+		"uris": ["spiffe://example.com/service"],
+		"emails": ["admin@example.com"],
+		"sig_alg": "ECDSA-SHA256",
+		"pubkey_alg": "ECDSA",
+		"fingerprint_sha256": "039058c6f2c0cb492c533b0a4d14ef77cc0f78abccced5287d84a1a2011cfb81"
+	}`, string(record))
+}
+
+func Test_hostGroups(t *testing.T) {
+	groups := make(hostGroups)
+
+	// host with 3 ports, one of them is not for output
+	results, complete := groups.add(&procResult{addr: "10.0.0.1:443", hostPorts: 3}, true)
+	assert.False(t, complete)
+	assert.Nil(t, results)
+
+	// single-port host is not buffered
+	results, complete = groups.add(&procResult{addr: "10.0.0.2:443", hostPorts: 1}, true)
+	assert.True(t, complete)
+	assert.Len(t, results, 1)
+
+	_, complete = groups.add(&procResult{addr: "10.0.0.1:8443", hostPorts: 3}, false)
+	assert.False(t, complete)
+
+	results, complete = groups.add(&procResult{addr: "10.0.0.1:80", hostPorts: 3, err: syscall.ECONNREFUSED}, true)
+	assert.True(t, complete)
+	assert.Len(t, results, 2)
+	assert.Empty(t, groups)
+
+	assert.Equal(t, "10.0.0.1 -- 80: refused: connection refused -- 443: []", hostGroupLine(results)[:len("10.0.0.1 -- 80: refused: connection refused -- 443: []")])
+}
+
+func Test_issuer(t *testing.T) {
+	result := &procResult{issuerCN: "R3", issuerOrg: []string{"Let's Encrypt"}}
+	assert.Equal(t, "CN=R3, O=Let's Encrypt", issuerString(result))
+	assert.True(t, issuerContains(result, "let's encrypt"))
+	assert.True(t, issuerContains(result, "R3"))
+	assert.False(t, issuerContains(result, "DigiCert"))
+
+	assert.Equal(t, "", issuerString(&procResult{}))
+}
+
+func Test_matchesDomain(t *testing.T) {
+	domains := []string{"example.com", "foo.net"}
+	cases := []struct {
+		name     string
+		expected bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"*.example.com", true},
+		{"WWW.Example.COM.", true},
+		{"a.b.foo.net", true},
+		{"evilexample.com", false},
+		{"example.com.evil.org", false},
+		{"foo.network", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, matchesDomain(c.name, domains), c.name)
+	}
+}
+
+func Benchmark_outputBuffer(b *testing.B) {
+	names := make([]string, 10000)
+	for i := range names {
+		names[i] = fmt.Sprintf("host-%d.example.com", i)
+	}
+
+	f, err := os.Create(filepath.Join(b.TempDir(), "out.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	// every name is written straight to file, or through output buffer
+	for _, size := range []int{0, outputBufferSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			var out io.Writer = f
+			var buffered *bufio.Writer
+			if size > 0 {
+				buffered = bufio.NewWriterSize(f, size)
+				out = buffered
+			}
+			for i := 0; i < b.N; i++ {
+				for _, name := range names {
+					fmt.Fprintln(out, name)
+				}
+				if buffered != nil {
+					buffered.Flush()
+				}
+			}
+		})
+	}
+}
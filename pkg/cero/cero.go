@@ -0,0 +1,670 @@
+// Package cero grabs certificates presented by TLS servers and scrapes domain names out of them.
+// It is the core of cero command-line tool, exposed for embedding into other programs.
+package cero
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Options of certificate grabbing
+type Options struct {
+	// Timeout of connecting (including negotiation with proxy), zero for none
+	Timeout time.Duration
+
+	// timeout of STARTTLS negotiation and TLS handshake, counted from connection (Timeout if zero),
+	// so that host, that accepts connection but stalls the handshake, is not waited for longer than intended
+	HandshakeTimeout time.Duration
+
+	// Ports to use for targets without explicit port (see ParseTarget and ParsePorts)
+	Ports []string
+
+	// SNI to send to every target. if empty, domain names are sent as SNI (unless NoSNI is set), IPs get no SNI
+	SNI   string
+	NoSNI bool
+
+	// strip IPs, wildcard domains and gibberish from Result.Names
+	OnlyValidDomainNames bool
+
+	// decode punycode labels of Result.Names into Unicode, and consider internationalized domain names valid (see IsDomainNameIDN)
+	IDN bool
+
+	// keep wildcard domain names (*.example.com) along with valid ones (see OnlyValidDomainNames).
+	// with StripWildcards, wildcard names are reported as their base domain (example.com)
+	Wildcards      bool
+	StripWildcards bool
+
+	// report fully qualified names without trailing dot (example.com. as example.com), without repeats
+	StripTrailingDot bool
+
+	// add IP addresses from SANs to Result.Names (kept even with OnlyValidDomainNames)
+	IncludeIPSANs bool
+
+	// take only CommonName, or only SANs (even the one equal to CommonName) into Result.Names, instead of both.
+	// mutually exclusive
+	CommonNameOnly bool
+	SANsOnly       bool
+
+	// consider names with underscore labels (_dmarc.example.com) valid (see IsServiceDomainName)
+	AllowUnderscore bool
+
+	// browser to present ClientHello of (see MimicBrowsers), empty for Go default
+	Mimic string
+
+	// protocol to negotiate TLS over with STARTTLS (see STARTTLSProtocols), empty for plain TLS
+	STARTTLS string
+
+	// negotiate STARTTLS by port dialed: ftp on 21, smtp on 25 and 587, pop3 on 110, imap on 143, ldap on 389, xmpp on 5222, postgres on 5432, plain TLS on other ports.
+	// can not be combined with STARTTLS
+	AutoSTARTTLS bool
+
+	// perform QUIC handshake over UDP instead of TLS over TCP (always TLS 1.3, h3 is advertised, unless ALPN is set).
+	// can not be combined with Mimic, STARTTLS or Proxy. domain names are dialed at the first of their IPs
+	QUIC bool
+
+	// number of retries of transient network failures (timeouts, and connection resets with RetryResets),
+	// delayed with exponential backoff, starting at RetryBackoff (250ms if zero), with jitter
+	Retries      int
+	RetryBackoff time.Duration
+
+	// retry connections reset by peer too. otherwise resets are fatal, like refused connections
+	RetryResets bool
+
+	// limiter of connection rate, waited before every connection attempt (retries included),
+	// e.g. *rate.Limiter of golang.org/x/time/rate. nil for no limit
+	Limiter Limiter
+
+	// SOCKS5 proxy to connect through: socks5://[user:password@]host:port, nil for direct connections
+	Proxy *url.URL
+
+	// local address to connect from (port is usually zero), nil to let system choose one.
+	// IPv6 link-local address requires zone
+	LocalAddr *net.TCPAddr
+
+	// resolver of domain names to dial (see NewResolver), nil for system one.
+	// with proxy, names are resolved by proxy itself
+	Resolver *net.Resolver
+
+	// resolves domain names to dial instead of dialer (e.g. to cache lookups), nil to let dialer resolve them with Resolver.
+	// resolved IPs are dialed in turn, until connection succeeds. not used with proxy
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	// range of TLS versions to offer (see ParseTLSVersion), zero for defaults of crypto/tls.
+	// with a tight range, handshake fails with hosts that refuse those versions
+	MinVersion uint16
+	MaxVersion uint16
+
+	// application protocols to advertise with ALPN (e.g. h2, http/1.1), none if empty.
+	// browsers to mimic advertise their own protocols
+	ALPN []string
+
+	// client certificates to present, when server requests one (mTLS). the first one, supported by server, is presented.
+	// if server requests client certificate, and handshake fails, error is of class ClassClientCert
+	Certificates []tls.Certificate
+
+	// collect names from every certificate of the chain, not only from leaf (see Result.ChainNames)
+	FullChain bool
+}
+
+// Validate checks that options refer to supported browser, STARTTLS protocol, proxy and TLS version,
+// and do not combine mutually exclusive ones
+func (opts *Options) Validate() error {
+	if _, ok := mimicHellos[opts.Mimic]; opts.Mimic != "" && !ok {
+		return fmt.Errorf("unknown browser to mimic: %s", opts.Mimic)
+	}
+	if _, ok := starttlsNegotiators[opts.STARTTLS]; opts.STARTTLS != "" && !ok {
+		return fmt.Errorf("unsupported STARTTLS protocol: %s", opts.STARTTLS)
+	}
+	if opts.Proxy != nil && opts.Proxy.Scheme != "socks5" && opts.Proxy.Scheme != "socks5h" {
+		return fmt.Errorf("unsupported proxy scheme: %s", opts.Proxy.Scheme)
+	}
+	if opts.STARTTLS != "" && opts.AutoSTARTTLS {
+		return errors.New("STARTTLS protocol and automatic STARTTLS are mutually exclusive")
+	}
+	if opts.QUIC && (opts.Mimic != "" || opts.STARTTLS != "" || opts.AutoSTARTTLS || opts.Proxy != nil) {
+		return errors.New("QUIC can not be combined with browser to mimic, STARTTLS or proxy")
+	}
+	if opts.QUIC && opts.MaxVersion != 0 && opts.MaxVersion < tls.VersionTLS13 {
+		return fmt.Errorf("QUIC requires TLS 1.3, maximum TLS version is %s", TLSVersionName(opts.MaxVersion))
+	}
+	if opts.CommonNameOnly && opts.SANsOnly {
+		return errors.New("only CommonName and only SANs are mutually exclusive")
+	}
+	if opts.MinVersion != 0 && !isTLSVersion(opts.MinVersion) {
+		return fmt.Errorf("unsupported minimum TLS version: %s", TLSVersionName(opts.MinVersion))
+	}
+	if opts.MaxVersion != 0 && !isTLSVersion(opts.MaxVersion) {
+		return fmt.Errorf("unsupported maximum TLS version: %s", TLSVersionName(opts.MaxVersion))
+	}
+	if opts.MinVersion != 0 && opts.MaxVersion != 0 && opts.MinVersion > opts.MaxVersion {
+		return fmt.Errorf("minimum TLS version %s is above maximum %s", TLSVersionName(opts.MinVersion), TLSVersionName(opts.MaxVersion))
+	}
+	return nil
+}
+
+// Result of grabbing certificate of a single target
+type Result struct {
+	Addr      string
+	Chain     []*x509.Certificate // chain presented by the server, Chain[0] is leaf
+	Names     []string            // CommonName and SANs of leaf (of every certificate of the chain, with FullChain)
+	NotBefore time.Time
+	NotAfter  time.Time
+	IssuerCN  string
+	IssuerOrg []string
+	SHA256    string // hex fingerprint of leaf
+
+	// whether leaf is signed by itself (see IsSelfSigned). root CA, presented after leaf, does not count
+	SelfSigned bool
+
+	// public key algorithm of leaf, and size of its key in bits (size of curve for ECDSA, zero for DSA), see IsWeakKey
+	PublicKeyAlgorithm x509.PublicKeyAlgorithm
+	PublicKeyBits      int
+
+	// negotiated TLS version and cipher suite (see TLSVersionName and tls.CipherSuiteName)
+	Version     uint16
+	CipherSuite uint16
+
+	// application protocol negotiated with ALPN, empty if none
+	ALPN string
+
+	// address actually dialed (e.g. IP of domain name). address of proxy, if connected through one
+	RemoteAddr string
+
+	// names of every certificate of Chain (only with FullChain), Names are their union without repeats
+	ChainNames [][]string
+
+	// domain name, leaf was checked against: SNI, or domain name dialed (empty for IP dialed without SNI),
+	// and whether leaf is valid for it (regardless of trust in the chain)
+	Hostname      string
+	HostnameMatch bool
+}
+
+// ErrNoCertificates is returned when server completes handshake without presenting any certificate
+// (misbehaving servers or anonymous cipher suites)
+var ErrNoCertificates = errors.New("no certificates presented")
+
+// Limiter limits rate of connections. Wait blocks until connection is allowed, or ctx is cancelled
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// GrabCert connects to addr (host:port), performs TLS handshake and returns information on presented certificate.
+// cancellation of ctx interrupts dialing, STARTTLS negotiation and handshake.
+// class of returned error can be determined with ClassifyError
+func GrabCert(ctx context.Context, addr string, opts *Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := grabChain(ctx, addr, serverName(host, opts), opts)
+	for attempt := 0; attempt < opts.Retries && isTransient(err, opts.RetryResets) && ctx.Err() == nil; attempt++ {
+		if err := sleepContext(ctx, backoff(opts.RetryBackoff, attempt)); err != nil {
+			return nil, err
+		}
+		state, err = grabChain(ctx, addr, serverName(host, opts), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := state.chain[0]
+	result := &Result{
+		Addr:      addr,
+		Chain:     state.chain,
+		Names:     certNames(leaf, opts),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		IssuerCN:  leaf.Issuer.CommonName,
+		IssuerOrg: leaf.Issuer.Organization,
+		SHA256:    fingerprint(leaf),
+
+		SelfSigned: IsSelfSigned(leaf),
+
+		Version:     state.version,
+		CipherSuite: state.cipherSuite,
+		ALPN:        state.alpn,
+		RemoteAddr:  state.remoteAddr,
+
+		PublicKeyAlgorithm: leaf.PublicKeyAlgorithm,
+		PublicKeyBits:      publicKeyBits(leaf.PublicKey),
+	}
+
+	if opts.FullChain {
+		result.ChainNames, result.Names = chainNames(state.chain, opts)
+	}
+
+	// mismatch reveals default virtual host, or misconfigured SNI
+	result.Hostname = opts.SNI
+	if result.Hostname == "" && net.ParseIP(host) == nil {
+		result.Hostname = host
+	}
+	if result.Hostname != "" {
+		result.HostnameMatch = leaf.VerifyHostname(result.Hostname) == nil
+	}
+	return result, nil
+}
+
+// returns names of every certificate of chain, and their union (in order of the chain, without repeats)
+func chainNames(chain []*x509.Certificate, opts *Options) ([][]string, []string) {
+	perCert := make([][]string, len(chain))
+	var union []string
+	seen := make(map[string]struct{})
+	for i, cert := range chain {
+		perCert[i] = certNames(cert, opts)
+		for _, name := range perCert[i] {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				union = append(union, name)
+			}
+		}
+	}
+	return perCert, union
+}
+
+// default ports of URL schemes, that imply TLS
+var schemePorts = map[string]string{
+	"https": "443",
+	"wss":   "443",
+	"smtps": "465",
+	"ldaps": "636",
+	"imaps": "993",
+	"pop3s": "995",
+}
+
+// SplitServerName splits optional '@servername' suffix off input (e.g. 1.2.3.4:443@example.com),
+// that sets SNI to send to this target only. serverName is empty, if there is no suffix.
+// URLs are returned as is, since '@' of URL separates its user info
+func SplitServerName(input string) (target, serverName string, err error) {
+	if strings.Contains(input, "://") {
+		return input, "", nil
+	}
+	target, serverName, found := strings.Cut(input, "@")
+	if !found {
+		return input, "", nil
+	}
+	if serverName == "" || strings.ContainsAny(serverName, "@:/[]") || net.ParseIP(serverName) != nil {
+		return "", "", fmt.Errorf("%s: invalid server name %q (must be domain name)", input, serverName)
+	}
+	return target, serverName, nil
+}
+
+// ParseTarget splits input (host, host:port, CIDR or CIDR:port, where port might be a range: 8000-8100)
+// into host and ports to use for it. ports of opts are used, if port is not specified explicitly.
+// input might also be URL (https://example.com/path): port is taken from it, or inferred from TLS scheme
+func ParseTarget(input string, opts *Options) (host string, ports []string, err error) {
+	if strings.Contains(input, "://") {
+		return parseURLTarget(input, opts)
+	}
+
+	host, port := SplitHostPort(input)
+	if port == "" {
+		// non-numeric port of domain name or IPv4 (IPv6 has more colons)
+		if _, port, found := strings.Cut(host, ":"); found && !strings.Contains(port, ":") {
+			_, err := parsePortNumber(port)
+			return "", nil, err
+		}
+		return host, opts.Ports, nil
+	}
+	if ports, err = ParsePorts(port); err != nil {
+		return "", nil, err
+	}
+	return host, ports, nil
+}
+
+// parses URL input into host and ports to use for it, path and query are dropped
+func parseURLTarget(input string, opts *Options) (host string, ports []string, err error) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Hostname() == "" {
+		return "", nil, fmt.Errorf("%s: URL has no host", input)
+	}
+
+	switch port, ok := schemePorts[strings.ToLower(u.Scheme)]; {
+	case u.Port() != "":
+		ports, err = ParsePorts(u.Port())
+	case ok:
+		ports = []string{port}
+	default:
+		ports = opts.Ports
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return u.Hostname(), ports, nil
+}
+
+// reports whether err is a network failure, that is worth retrying: timeout, or connection reset (if resets is set)
+func isTransient(err error, resets bool) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() || resets && errors.Is(err, syscall.ECONNRESET)
+}
+
+// default delay before the first retry
+const defaultRetryBackoff = 250 * time.Millisecond
+
+// returns delay before retry: base doubled for every previous attempt, randomized within [delay/2, delay)
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	if attempt > 16 {
+		attempt = 16
+	}
+	delay := base << attempt
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// sleeps for d, returns early with error if ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// returns SNI to send to host: the one forced in options, or domain name itself
+// (so that virtual hosts present their own certificates). nothing is sent for IPs
+func serverName(host string, opts *Options) string {
+	switch {
+	case opts.SNI != "":
+		return opts.SNI
+	case opts.NoSNI || net.ParseIP(host) != nil:
+		return ""
+	}
+	return host
+}
+
+// parameters of completed TLS handshake
+type handshakeState struct {
+	chain       []*x509.Certificate // presented by the server, never empty
+	version     uint16
+	cipherSuite uint16
+	alpn        string
+	remoteAddr  string
+}
+
+// connects to addr and grabs certificate chain presented during TLS handshake.
+// serverName is sent as SNI (if not empty)
+func grabChain(ctx context.Context, addr, serverName string, opts *Options) (*handshakeState, error) {
+	// wait for turn to connect (not counted in timeout)
+	if opts.Limiter != nil {
+		if err := opts.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.QUIC {
+		return grabChainQUIC(ctx, addr, serverName, opts)
+	}
+
+	// dial
+	var dialDeadline time.Time
+	if opts.Timeout != 0 {
+		dialDeadline = time.Now().Add(opts.Timeout)
+	}
+	conn, err := dial(ctx, addr, dialDeadline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// handshake timeout covers the whole negotiation and handshake
+	handshakeTimeout := opts.HandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = opts.Timeout
+	}
+	var deadline time.Time
+	if handshakeTimeout != 0 {
+		deadline = time.Now().Add(handshakeTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// negotiate TLS over plaintext protocol
+	if negotiator, ok := starttlsNegotiatorFor(addr, opts); ok {
+		domain := serverName
+		if domain == "" {
+			domain, _, _ = net.SplitHostPort(addr)
+		}
+		if err := negotiateContext(ctx, conn, negotiator, domain); err != nil {
+			return nil, &stageError{ClassSTARTTLS, err}
+		}
+	}
+
+	if opts.Mimic != "" {
+		return handshakeMimic(ctx, conn, serverName, mimicHellos[opts.Mimic], opts)
+	}
+
+	var certRequested bool
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         serverName,
+		MinVersion:         opts.MinVersion,
+		MaxVersion:         opts.MaxVersion,
+		NextProtos:         opts.ALPN,
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certRequested = true
+			return clientCertificate(info, opts.Certificates), nil
+		},
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, handshakeError(err, certRequested)
+	}
+
+	state := tlsConn.ConnectionState()
+	chain, err := presentedChain(state.PeerCertificates)
+	if err != nil {
+		return nil, err
+	}
+	return &handshakeState{
+		chain:       chain,
+		version:     state.Version,
+		cipherSuite: state.CipherSuite,
+		alpn:        state.NegotiatedProtocol,
+		remoteAddr:  conn.RemoteAddr().String(),
+	}, nil
+}
+
+// returns the first of client certificates, supported by server (empty one, if none is)
+func clientCertificate(info *tls.CertificateRequestInfo, certs []tls.Certificate) *tls.Certificate {
+	for i := range certs {
+		if info.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i]
+		}
+	}
+	return &tls.Certificate{}
+}
+
+// classifies failure of handshake: server, that requested client certificate, most likely failed because of it
+func handshakeError(err error, certRequested bool) error {
+	if certRequested {
+		return &stageError{ClassClientCert, err}
+	}
+	return &stageError{ClassHandshake, err}
+}
+
+// connects to addr, directly or through proxy, before deadline (zero for none)
+func dial(ctx context.Context, addr string, deadline time.Time, opts *Options) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: opts.Timeout, Resolver: opts.Resolver}
+	if opts.LocalAddr != nil {
+		dialer.LocalAddr = opts.LocalAddr
+	}
+	if opts.Proxy == nil {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || opts.LookupIPAddr == nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+		return dialResolved(ctx, dialer, host, port, deadline, opts.LookupIPAddr)
+	}
+
+	proxyDialer, err := proxy.FromURL(opts.Proxy, dialer)
+	if err != nil {
+		return nil, err
+	}
+
+	// timeout of dialer covers only connection to proxy, deadline covers proxy negotiation as well
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	if contextDialer, ok := proxyDialer.(proxy.ContextDialer); ok {
+		return contextDialer.DialContext(ctx, "tcp", addr)
+	}
+	return proxyDialer.Dial("tcp", addr)
+}
+
+// resolves host with lookup, and dials its IPs in turn until connection succeeds (all within deadline).
+// returns error of the first IP, if none succeeds
+func dialResolved(ctx context.Context, dialer *net.Dialer, host, port string, deadline time.Time, lookup func(ctx context.Context, host string) ([]net.IPAddr, error)) (net.Conn, error) {
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// checks that chain presented during handshake contains at least leaf certificate
+func presentedChain(chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, ErrNoCertificates
+	}
+	return chain, nil
+}
+
+// IsSelfSigned reports whether certificate is signed by itself: it is issued by its own subject,
+// and its signature verifies with its own key (regardless of whether it's allowed to sign as CA)
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+/* returns hex-encoded SHA-256 fingerprint of certificate */
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+/* returns slice of domain names from certificate (CommonName and all SANs) */
+func certNames(cert *x509.Certificate, opts *Options) []string {
+	isDomainName := func(name string) bool {
+		if opts.IDN {
+			return isDomainNameIDN(name, opts.AllowUnderscore)
+		}
+		return isDomainName(name, opts.AllowUnderscore)
+	}
+
+	// wildcard is allowed only as the whole leftmost label
+	isWildcard := func(name string) bool {
+		return strings.HasPrefix(name, "*.") && isDomainName(name[2:])
+	}
+	isValid := func(name string) bool {
+		return isDomainName(name) || opts.Wildcards && isWildcard(name)
+	}
+
+	// get CommonName (if any) and all SANs into a slice
+	names := make([]string, 0, len(cert.DNSNames)+1)
+	withCN := !opts.SANsOnly && cert.Subject.CommonName != "" && (opts.OnlyValidDomainNames && isValid(cert.Subject.CommonName) || !opts.OnlyValidDomainNames)
+	if withCN {
+		names = append(names, cert.Subject.CommonName)
+	}
+	sans, ipSANs := cert.DNSNames, cert.IPAddresses
+	if opts.CommonNameOnly {
+		sans, ipSANs = nil, nil
+	}
+
+	// append all SANs, excluding one that is equal to CN (if it's there)
+	for _, name := range sans {
+		if !withCN || name != cert.Subject.CommonName {
+			if opts.OnlyValidDomainNames && isValid(name) || !opts.OnlyValidDomainNames {
+				names = append(names, name)
+			}
+		}
+	}
+
+	// append IP SANs, excluding one that is equal to CN (if it's there)
+	if opts.IncludeIPSANs {
+		for _, ip := range ipSANs {
+			if name := ip.String(); !withCN || name != cert.Subject.CommonName {
+				names = append(names, name)
+			}
+		}
+	}
+
+	// surface base domains of wildcards (and names without trailing dot), without repeating names already present
+	if opts.StripWildcards || opts.StripTrailingDot {
+		seen := make(map[string]struct{}, len(names))
+		stripped := names[:0]
+		for _, name := range names {
+			if opts.StripTrailingDot && len(name) > 1 {
+				name = strings.TrimSuffix(name, ".")
+			}
+			if opts.StripWildcards && isWildcard(name) {
+				name = name[2:]
+			}
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				stripped = append(stripped, name)
+			}
+		}
+		names = stripped
+	}
+
+	// display internationalized names in Unicode
+	if opts.IDN {
+		for i, name := range names {
+			names[i] = ToUnicode(name)
+		}
+	}
+
+	return names
+}
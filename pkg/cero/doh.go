@@ -0,0 +1,219 @@
+package cero
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maximum time to cache answers of DoH endpoint for, regardless of TTL of their records
+var maxDoHTTL = 5 * time.Minute
+
+// NewDoHResolver returns resolver, that queries DNS-over-HTTPS endpoint (RFC 8484, wire format over POST),
+// e.g. https://cloudflare-dns.com/dns-query. timeout limits every request (zero for none).
+// answers are cached by resolver for TTL of their records (5 minutes at most), so that the same name is queried once in a while.
+// names, that do not exist, are queried every time: negative caching with TTL is up to caller
+func NewDoHResolver(endpoint string, timeout time.Duration) (*net.Resolver, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("%s: DoH endpoint must be https://host/path", endpoint)
+	}
+
+	c := &dohClient{endpoint: endpoint, client: &http.Client{Timeout: timeout}, answers: make(map[string]dohAnswer)}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: c}, nil
+		},
+	}, nil
+}
+
+// client of DoH endpoint, caching answers by question
+type dohClient struct {
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	answers map[string]dohAnswer // keyed by query without its ID
+}
+
+// cached answer of DoH endpoint
+type dohAnswer struct {
+	message []byte
+	expires time.Time
+}
+
+// sends query (wire format) to endpoint, returns answer
+func (c *dohClient) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, errors.New("DNS query is too short")
+	}
+	key := string(query[2:])
+
+	c.mu.Lock()
+	cached, ok := c.answers[key]
+	if ok && !time.Now().Before(cached.expires) {
+		delete(c.answers, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	answer := cached.message
+
+	if !ok {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(query))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/dns-message")
+		req.Header.Set("Accept", "application/dns-message")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("DoH endpoint responded with %s", resp.Status)
+		}
+		if answer, err = io.ReadAll(io.LimitReader(resp.Body, 65535)); err != nil {
+			return nil, err
+		}
+		if len(answer) < 12 {
+			return nil, errors.New("DoH endpoint responded with invalid DNS message")
+		}
+
+		// only successful answers are cached (not NXDOMAIN, nor server failures), for TTL of their records
+		if rcode := answer[3] & 0x0F; rcode == 0 {
+			if ttl := answerTTL(answer); ttl > 0 {
+				c.mu.Lock()
+				c.answers[key] = dohAnswer{message: answer, expires: time.Now().Add(ttl)}
+				c.mu.Unlock()
+			}
+		}
+	}
+
+	// answer must carry ID of the query
+	answer = append([]byte(nil), answer...)
+	copy(answer, query[:2])
+	return answer, nil
+}
+
+// returns how long answer (DNS message) may be cached for: the minimal TTL of its answer and authority records,
+// capped at maxDoHTTL. zero if answer has no records, or can not be parsed
+func answerTTL(answer []byte) time.Duration {
+	var p dnsmessage.Parser
+	if _, err := p.Start(answer); err != nil {
+		return 0
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0
+	}
+
+	ttl, found := maxDoHTTL, false
+	sections := []struct {
+		header func() (dnsmessage.ResourceHeader, error)
+		skip   func() error
+	}{
+		{p.AnswerHeader, p.SkipAnswer},
+		{p.AuthorityHeader, p.SkipAuthority},
+	}
+	for _, section := range sections {
+		for {
+			header, err := section.header()
+			if errors.Is(err, dnsmessage.ErrSectionDone) {
+				break
+			}
+			if err != nil {
+				return 0
+			}
+			if d := time.Duration(header.TTL) * time.Second; d < ttl {
+				ttl = d
+			}
+			found = true
+			if err := section.skip(); err != nil {
+				return 0
+			}
+		}
+	}
+	if !found {
+		return 0
+	}
+	return ttl
+}
+
+// connection, that resolver speaks DNS over TCP with (messages are prefixed with their length).
+// query written is exchanged with DoH endpoint once its answer is read
+type dohConn struct {
+	ctx      context.Context
+	client   *dohClient
+	deadline time.Time
+
+	query  bytes.Buffer
+	answer bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.query.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.answer.Len() == 0 {
+		query := c.query.Bytes()
+		if len(query) < 2 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		length := int(binary.BigEndian.Uint16(query))
+		if len(query) < 2+length {
+			return 0, io.ErrUnexpectedEOF
+		}
+		query = query[2 : 2+length]
+		c.query.Reset()
+
+		ctx := c.ctx
+		if !c.deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, c.deadline)
+			defer cancel()
+		}
+
+		answer, err := c.client.exchange(ctx, query)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				// resolver expects timeout of the connection
+				return 0, os.ErrDeadlineExceeded
+			}
+			return 0, err
+		}
+		binary.Write(&c.answer, binary.BigEndian, uint16(len(answer)))
+		c.answer.Write(answer)
+	}
+	return c.answer.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr{} }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// address of DoH endpoint, as seen by resolver
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
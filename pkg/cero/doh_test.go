@@ -0,0 +1,126 @@
+package cero
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNewDoHResolver(t *testing.T) {
+	zone := map[string]string{"example.test.": "127.0.0.2"}
+
+	// DoH endpoint, counting queries
+	var queries int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		answer, err := testDNSAnswer(query, zone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer)
+	}))
+	defer ts.Close()
+
+	resolver, err := NewDoHResolver(ts.URL+"/dns-query", time.Second)
+	assert.NoError(t, err)
+
+	addrs, err := resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, addrs)
+
+	// answers are cached
+	sent := atomic.LoadInt32(&queries)
+	assert.NotZero(t, sent)
+	addrs, err = resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, addrs)
+	assert.Equal(t, sent, atomic.LoadInt32(&queries))
+
+	// unknown names are not found, and are queried again (they may be created during the run)
+	_, err = resolver.LookupHost(context.Background(), "unknown.test")
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+	sent = atomic.LoadInt32(&queries)
+	_, err = resolver.LookupHost(context.Background(), "unknown.test")
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+	assert.Greater(t, atomic.LoadInt32(&queries), sent)
+
+	// answers expire
+	defer func(ttl time.Duration) { maxDoHTTL = ttl }(maxDoHTTL)
+	maxDoHTTL = 50 * time.Millisecond
+	resolver, err = NewDoHResolver(ts.URL+"/dns-query", time.Second)
+	assert.NoError(t, err)
+	_, err = resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	sent = atomic.LoadInt32(&queries)
+	time.Sleep(100 * time.Millisecond)
+	_, err = resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Greater(t, atomic.LoadInt32(&queries), sent)
+
+	// failing endpoint fails resolution
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	resolver, err = NewDoHResolver(failing.URL, time.Second)
+	assert.NoError(t, err)
+	_, err = resolver.LookupHost(context.Background(), "example.test")
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+
+	// invalid endpoints
+	for _, endpoint := range []string{"", "dns.example.com", "ftp://dns.example.com/dns-query", "https:///dns-query", "%"} {
+		_, err := NewDoHResolver(endpoint, time.Second)
+		assert.Error(t, err, endpoint)
+	}
+}
+
+func Test_answerTTL(t *testing.T) {
+	query := func(name string, qtype dnsmessage.Type) []byte {
+		msg := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}}}
+		packed, err := msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packed
+	}
+	zone := map[string]string{"example.test.": "127.0.0.2"}
+
+	// TTL of A record
+	answer, err := testDNSAnswer(query("example.test.", dnsmessage.TypeA), zone)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 60*time.Second, answerTTL(answer))
+	}
+
+	// TTL of SOA record, accompanying empty answer
+	answer, err = testDNSAnswer(query("example.test.", dnsmessage.TypeAAAA), zone)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 60*time.Second, answerTTL(answer))
+	}
+
+	// capped
+	defer func(ttl time.Duration) { maxDoHTTL = ttl }(maxDoHTTL)
+	maxDoHTTL = 10 * time.Second
+	assert.Equal(t, 10*time.Second, answerTTL(answer))
+
+	// no records, or garbage
+	answer, err = testDNSAnswer(query("unknown.test.", dnsmessage.TypeA), zone)
+	if assert.NoError(t, err) {
+		assert.Zero(t, answerTTL(answer))
+	}
+	assert.Zero(t, answerTTL([]byte("garbage")))
+}
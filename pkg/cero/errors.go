@@ -0,0 +1,76 @@
+package cero
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// classes of errors, returned by GrabCert
+const (
+	ClassTimeout        = "timeout"         // dial, negotiation or handshake timed out
+	ClassRefused        = "refused"         // port is closed
+	ClassReset          = "reset"           // connection was reset by peer
+	ClassUnreachable    = "unreachable"     // no route to host or network
+	ClassDNS            = "dns"             // domain name could not be resolved
+	ClassSTARTTLS       = "starttls"        // plaintext protocol refused to start TLS
+	ClassHandshake      = "handshake"       // TLS handshake failed (e.g. service does not speak TLS)
+	ClassClientCert     = "client-cert"     // TLS handshake failed after server requested client certificate (mTLS)
+	ClassNoCertificates = "no-certificates" // handshake completed without certificates
+	ClassCancelled      = "cancelled"       // context was cancelled
+	ClassOther          = "other"
+)
+
+// ErrorClasses lists all classes of errors, returned by ClassifyError
+var ErrorClasses = []string{
+	ClassTimeout, ClassRefused, ClassReset, ClassUnreachable, ClassDNS,
+	ClassSTARTTLS, ClassHandshake, ClassClientCert, ClassNoCertificates, ClassCancelled, ClassOther,
+}
+
+// error of particular stage of connection, message of underlying error is kept as is
+type stageError struct {
+	class string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// ClassifyError returns class of error, returned by GrabCert (empty for nil error).
+// network failures take precedence over the stage, they occurred at: e.g. handshake that timed out is a timeout
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		netErr    net.Error
+		dnsErr    *net.DNSError
+		recordErr tls.RecordHeaderError
+		stageErr  *stageError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ClassCancelled
+	case errors.As(err, &dnsErr):
+		return ClassDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ClassRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ClassReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ClassUnreachable
+	case errors.Is(err, ErrNoCertificates):
+		return ClassNoCertificates
+	case errors.As(err, &recordErr):
+		return ClassHandshake
+	case errors.As(err, &stageErr):
+		return stageErr.class
+	}
+	return ClassOther
+}
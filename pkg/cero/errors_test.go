@@ -0,0 +1,68 @@
+package cero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{context.Canceled, ClassCancelled},
+		{&stageError{ClassHandshake, context.Canceled}, ClassCancelled},
+		{&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, ClassTimeout},
+		{&stageError{ClassHandshake, os.ErrDeadlineExceeded}, ClassTimeout},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ClassRefused},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, ClassReset},
+		{&net.OpError{Op: "dial", Err: syscall.EHOSTUNREACH}, ClassUnreachable},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nx.example.com"}}, ClassDNS},
+		{ErrNoCertificates, ClassNoCertificates},
+		{&stageError{ClassSTARTTLS, errors.New("imap: STARTTLS refused")}, ClassSTARTTLS},
+		{&stageError{ClassHandshake, errors.New("remote error: tls: handshake failure")}, ClassHandshake},
+		{fmt.Errorf("wrapped: %w", ErrNoCertificates), ClassNoCertificates},
+		{errors.New("something else"), ClassOther},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, ClassifyError(c.err), fmt.Sprint(c.err))
+	}
+}
+
+func TestGrabCert_errorClass(t *testing.T) {
+	// plaintext service, that does not speak TLS
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("HTTP/1.0 400 Bad Request\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+
+	_, err = GrabCert(context.Background(), ln.Addr().String(), &Options{Timeout: time.Second})
+	assert.Equal(t, ClassHandshake, ClassifyError(err), err)
+
+	// the same port, closed
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = GrabCert(context.Background(), addr, &Options{Timeout: time.Second})
+	assert.Equal(t, ClassRefused, ClassifyError(err), err)
+}
@@ -0,0 +1,38 @@
+package cero
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// IsDomainNameIDN is like IsDomainName, but also accepts internationalized domain names:
+// Unicode ones, and ones with punycode (xn--) labels, that decode into valid Unicode labels
+func IsDomainNameIDN(s string) bool {
+	return isDomainNameIDN(s, false)
+}
+
+// lookup profile, that leaves underscores to be checked by isDomainName
+var lookupUnderscore = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+func isDomainNameIDN(s string, allowUnderscore bool) bool {
+	profile := idna.Lookup
+	if allowUnderscore {
+		profile = lookupUnderscore
+	}
+	ascii, err := profile.ToASCII(strings.TrimSuffix(s, "."))
+	if err != nil {
+		return false
+	}
+	return isDomainName(ascii, allowUnderscore)
+}
+
+// ToUnicode decodes punycode labels of name into Unicode for display.
+// labels that are not punycode (including wildcards) are kept as is, as well as whole name, if it does not decode
+func ToUnicode(name string) string {
+	unicode, err := idna.Punycode.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
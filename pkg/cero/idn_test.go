@@ -0,0 +1,63 @@
+package cero
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDomainNameIDN(t *testing.T) {
+	cases := []struct {
+		host     string
+		expected bool
+	}{
+		// -- valid
+		{"example.com", true},
+		{"xn--80ak6aa92e.com", true},
+		{"xn--e1afmkfd.xn--p1ai", true},
+		{"xn--e1afmkfd.xn--p1ai.", true},
+		{"пример.рф", true},
+
+		// -- invalid
+		{"xn--zz.com", false}, // invalid punycode
+		{"*.xn--80ak6aa92e.com", false},
+		{"127.0.0.1", false},
+		{"пример", false}, // single level
+		{"test_test.com", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, IsDomainNameIDN(c.host), c.host)
+	}
+
+	// strict validation does not change
+	assert.False(t, IsDomainName("пример.рф"))
+}
+
+func TestToUnicode(t *testing.T) {
+	cases := []struct {
+		name, expected string
+	}{
+		{"xn--80ak6aa92e.com", "аррӏе.com"},
+		{"*.xn--e1afmkfd.xn--p1ai", "*.пример.рф"},
+		{"www.example.com", "www.example.com"},
+		{"xn--zz.com", "xn--zz.com"}, // kept as is
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, ToUnicode(c.name), c.name)
+	}
+}
+
+func Test_certNames_IDN(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "xn--e1afmkfd.xn--p1ai"},
+		DNSNames: []string{"xn--e1afmkfd.xn--p1ai", "www.xn--e1afmkfd.xn--p1ai", "xn--zz.com"},
+	}
+
+	assert.Equal(t, []string{"xn--e1afmkfd.xn--p1ai", "www.xn--e1afmkfd.xn--p1ai", "xn--zz.com"}, certNames(cert, &Options{OnlyValidDomainNames: true}))
+	assert.Equal(t, []string{"пример.рф", "www.пример.рф"}, certNames(cert, &Options{OnlyValidDomainNames: true, IDN: true}))
+	assert.Equal(t, []string{"пример.рф", "www.пример.рф", "xn--zz.com"}, certNames(cert, &Options{IDN: true}))
+}
@@ -0,0 +1,122 @@
+package cero
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IsIPRange reports whether value looks like range of IPs: 10.0.0.1-10.0.0.254 or 10.0.0.1-254.
+// if it's not a valid one, it will fail at later processing
+func IsIPRange(value string) bool {
+	start, _, found := strings.Cut(value, "-")
+	return found && net.ParseIP(start) != nil
+}
+
+// parsed range of IPs: IPs share upper 8 bytes (in 16-byte form), lower halves are in [lo, lo+count)
+type ipRange struct {
+	hi    []byte
+	lo    uint64
+	count uint64
+}
+
+// parses range of IPs (inclusive), IPv4 end of range might be shortened to its last octet
+func parseIPRange(value string) (*ipRange, error) {
+	startStr, endStr, _ := strings.Cut(value, "-")
+	start := net.ParseIP(startStr)
+	if start == nil {
+		return nil, fmt.Errorf("%s: invalid start of IP range", value)
+	}
+
+	end := net.ParseIP(endStr)
+	if start4 := start.To4(); start4 != nil && end == nil {
+		// shorthand: last octet only
+		octet, err := strconv.ParseUint(endStr, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid end of IP range", value)
+		}
+		end = net.IPv4(start4[0], start4[1], start4[2], byte(octet))
+	}
+	if end == nil {
+		return nil, fmt.Errorf("%s: invalid end of IP range", value)
+	}
+
+	if (start.To4() == nil) != (end.To4() == nil) {
+		return nil, fmt.Errorf("%s: IP range mixes IPv4 and IPv6", value)
+	}
+
+	start, end = start.To16(), end.To16()
+	if string(start[:8]) != string(end[:8]) {
+		return nil, fmt.Errorf("%s: IPv6 range is too wide, IPs must share upper 64 bits", value)
+	}
+
+	lo, loEnd := binary.BigEndian.Uint64(start[8:]), binary.BigEndian.Uint64(end[8:])
+	switch {
+	case lo > loEnd:
+		return nil, fmt.Errorf("%s: start of IP range is after its end", value)
+	case loEnd-lo == math.MaxUint64:
+		return nil, fmt.Errorf("%s: IPv6 range is too wide, IPs must share upper 64 bits", value)
+	}
+	return &ipRange{hi: start[:8], lo: lo, count: loEnd - lo + 1}, nil
+}
+
+// IPRangeSize returns number of IPs in range
+func IPRangeSize(value string) (uint64, error) {
+	rng, err := parseIPRange(value)
+	if err != nil {
+		return 0, err
+	}
+	return rng.count, nil
+}
+
+// ExpandIPRange expands range of IPs (see IsIPRange) into atomic IPs, in ascending order.
+// channel contract is the same as of ExpandCIDR
+func ExpandIPRange(ctx context.Context, value string) (chan string, error) {
+	rng, err := parseIPRange(value)
+	if err != nil {
+		return nil, err
+	}
+	return rng.expand(ctx, func(offset uint64) uint64 { return offset }), nil
+}
+
+// ExpandIPRangeShuffled is like ExpandIPRange, but yields IPs in pseudo-random order,
+// determined by seed (the same seed gives the same order)
+func ExpandIPRangeShuffled(ctx context.Context, value string, seed uint64) (chan string, error) {
+	rng, err := parseIPRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// permute offsets of the enclosing power of 2, skipping ones out of range (cycle-walking)
+	permute := offsetPermutation(bits.Len64(rng.count-1), seed)
+	return rng.expand(ctx, func(offset uint64) uint64 {
+		for offset = permute(offset); offset >= rng.count; offset = permute(offset) {
+		}
+		return offset
+	}), nil
+}
+
+// yields IP at permute(offset) for every offset in the range
+func (rng *ipRange) expand(ctx context.Context, permute func(offset uint64) uint64) chan string {
+	outputChan := make(chan string)
+	go func() {
+		defer close(outputChan)
+
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, rng.hi)
+		for offset := uint64(0); offset < rng.count; offset++ {
+			binary.BigEndian.PutUint64(ip[8:], rng.lo+permute(offset))
+			select {
+			case outputChan <- ip.String():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return outputChan
+}
@@ -0,0 +1,80 @@
+package cero
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsIPRange(t *testing.T) {
+	assert.True(t, IsIPRange("10.0.0.1-10.0.0.254"))
+	assert.True(t, IsIPRange("10.0.0.1-254"))
+	assert.True(t, IsIPRange("fe80::1-fe80::ff"))
+	assert.False(t, IsIPRange("my-host.example.com"))
+	assert.False(t, IsIPRange("10.0.0.1"))
+	assert.False(t, IsIPRange("10.0.0.0/24"))
+}
+
+func TestExpandIPRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		rng     string
+		want    []string
+		wantErr bool
+	}{
+		{"IPv4", "10.0.0.254-10.0.1.1", []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}, false},
+		{"IPv4 shorthand", "10.0.0.1-3", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, false},
+		{"single IP", "10.0.0.1-10.0.0.1", []string{"10.0.0.1"}, false},
+		{"IPv6", "fe80::fffe-fe80::1:1", []string{"fe80::fffe", "fe80::ffff", "fe80::1:0", "fe80::1:1"}, false},
+		{"reversed", "10.0.0.5-10.0.0.1", nil, true},
+		{"mixed families", "10.0.0.1-fe80::1", nil, true},
+		{"IPv6 too wide", "fe80::1-fe81::1", nil, true},
+		{"IPv6 whole lower half", "fe80::-fe80::ffff:ffff:ffff:ffff", nil, true},
+		{"bad shorthand", "10.0.0.1-256", nil, true},
+		{"IPv6 shorthand", "fe80::1-ff", nil, true},
+		{"bad start", "10.0.0-10.0.0.5", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ips, err := ExpandIPRange(context.Background(), tt.rng)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandIPRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []string
+			for ip := range ips {
+				got = append(got, ip)
+			}
+			assert.Equal(t, tt.want, got)
+
+			size, err := IPRangeSize(tt.rng)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(len(tt.want)), size)
+		})
+	}
+}
+
+func TestExpandIPRangeShuffled(t *testing.T) {
+	ips, err := ExpandIPRangeShuffled(context.Background(), "10.0.0.10-10.0.0.109", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for ip := range ips {
+		got = append(got, ip)
+	}
+
+	var want []string
+	ascending, _ := ExpandIPRange(context.Background(), "10.0.0.10-10.0.0.109")
+	for ip := range ascending {
+		want = append(want, ip)
+	}
+
+	assert.ElementsMatch(t, want, got)
+	assert.NotEqual(t, want, got)
+}
@@ -0,0 +1,162 @@
+package cero
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// OID of StartTLS extended operation (RFC 4511)
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// message ID of StartTLS request (the first and only request of connection)
+const ldapMessageID = 1
+
+// maximum size of LDAP response to read (responses to StartTLS are tiny)
+const ldapMaxResponse = 64 << 10
+
+// BER tags of LDAP messages
+const (
+	berSequence             = 0x30
+	berInteger              = 0x02
+	berEnumerated           = 0x0a
+	ldapExtendedRequestTag  = 0x77 // [APPLICATION 23]
+	ldapExtendedResponseTag = 0x78 // [APPLICATION 24]
+	ldapRequestNameTag      = 0x80 // [0]
+)
+
+// LDAP (RFC 4511, 4513): StartTLS extended request, extended response with result code
+type ldapNegotiator struct{}
+
+func (ldapNegotiator) defaultPort() string { return "389" }
+
+func (ldapNegotiator) negotiate(conn net.Conn, _ string) error {
+	if _, err := conn.Write(ldapStartTLSRequest(ldapMessageID)); err != nil {
+		return err
+	}
+
+	// response is read exactly, TLS handshake follows right after it
+	tag, message, err := readBER(conn)
+	if err != nil {
+		return err
+	}
+	if tag != berSequence {
+		return fmt.Errorf("ldap: unexpected response: tag 0x%02x", tag)
+	}
+	return parseLDAPStartTLSResponse(message)
+}
+
+// returns BER-encoded LDAPMessage with StartTLS ExtendedRequest
+func ldapStartTLSRequest(messageID byte) []byte {
+	return append([]byte{
+		berSequence, 0x1d, // LDAPMessage
+		berInteger, 0x01, messageID, // messageID
+		ldapExtendedRequestTag, 0x18, // protocolOp: ExtendedRequest
+		ldapRequestNameTag, byte(len(ldapStartTLSOID)), // requestName
+	}, ldapStartTLSOID...)
+}
+
+// parses contents of LDAPMessage, that must be successful ExtendedResponse to StartTLS request
+func parseLDAPStartTLSResponse(message []byte) error {
+	tag, id, message, err := parseBER(message)
+	if err != nil {
+		return err
+	}
+	if tag != berInteger {
+		return fmt.Errorf("ldap: unexpected message ID: tag 0x%02x", tag)
+	}
+
+	tag, response, _, err := parseBER(message)
+	if err != nil {
+		return err
+	}
+	if tag != ldapExtendedResponseTag {
+		return fmt.Errorf("ldap: unexpected response: tag 0x%02x", tag)
+	}
+
+	tag, code, response, err := parseBER(response)
+	if err != nil {
+		return err
+	}
+	if tag != berEnumerated || len(code) == 0 || len(code) > 4 {
+		return errors.New("ldap: malformed result code")
+	}
+	var resultCode int
+	for _, b := range code {
+		resultCode = resultCode<<8 | int(b)
+	}
+
+	if resultCode != 0 {
+		// matchedDN, then diagnosticMessage
+		var diagnostic []byte
+		if _, _, response, err = parseBER(response); err == nil {
+			_, diagnostic, _, _ = parseBER(response)
+		}
+		return fmt.Errorf("ldap: StartTLS refused: result code %d: %s", resultCode, diagnostic)
+	}
+
+	// unsolicited notification (message ID 0) is not a response to StartTLS
+	if len(id) != 1 || id[0] != ldapMessageID {
+		return fmt.Errorf("ldap: unexpected message ID: %x", id)
+	}
+	return nil
+}
+
+// reads single BER element (with definite length) from r, without reading past its end
+func readBER(r io.Reader) (tag byte, content []byte, err error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	tag, length := header[0], int(header[1])
+
+	// long form of length
+	if length&0x80 != 0 {
+		size := make([]byte, length&0x7f)
+		if len(size) == 0 || len(size) > 3 {
+			return 0, nil, errors.New("ldap: unsupported length of BER element")
+		}
+		if _, err := io.ReadFull(r, size); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range size {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxResponse {
+		return 0, nil, fmt.Errorf("ldap: response is too large: %d bytes", length)
+	}
+
+	content = make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return tag, content, nil
+}
+
+// parses BER element (with definite length) at the start of b, returning the rest of b after it
+func parseBER(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("ldap: truncated BER element")
+	}
+	tag, length, b := b[0], int(b[1]), b[2:]
+
+	// long form of length
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 3 || len(b) < size {
+			return 0, nil, nil, errors.New("ldap: malformed length of BER element")
+		}
+		length = 0
+		for _, c := range b[:size] {
+			length = length<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < length {
+		return 0, nil, nil, errors.New("ldap: truncated BER element")
+	}
+	return tag, b[:length], b[length:], nil
+}
@@ -0,0 +1,57 @@
+package cero
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ldapStartTLSRequest(t *testing.T) {
+	// LDAPMessage {messageID 1, ExtendedRequest {requestName 1.3.6.1.4.1.1466.20037}}
+	want := "301d02010177188016" + hex.EncodeToString([]byte("1.3.6.1.4.1.1466.20037"))
+	assert.Equal(t, want, hex.EncodeToString(ldapStartTLSRequest(1)))
+}
+
+func Test_ldapNegotiator(t *testing.T) {
+	request := string(ldapStartTLSRequest(ldapMessageID))
+	tests := []struct {
+		name     string
+		response string // hex
+		wantErr  string
+	}{
+		{"success", "300c02010178070a010004000400", ""},
+		{"long form length", "30810c02010178070a010004000400", ""},
+		{"unwilling to perform", "301702010178120a0135040004" + "0b" + hex.EncodeToString([]byte("unsupported")), "result code 53: unsupported"},
+		{"protocol error without diagnostic", "300802010178030a0102", "result code 2"},
+		{"notice of disconnection", "300c02010078070a010004000400", "unexpected message ID"},
+		{"not extended response", "300c02010165070a010004000400", "unexpected response"},
+		{"not LDAPMessage", "0a0100", "unexpected response"},
+		{"truncated", "300c020101780708", "EOF"},
+		{"malformed", "30040201017808", "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := hex.DecodeString(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn := &fakeConn{server: strings.NewReader(string(response) + "tls")}
+			err = ldapNegotiator{}.negotiate(conn, "example.com")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+			assert.Equal(t, request, conn.written.String())
+
+			// response is consumed exactly, not a byte of TLS handshake
+			if tt.wantErr == "" {
+				rest := make([]byte, 3)
+				n, _ := conn.Read(rest)
+				assert.Equal(t, "tls", string(rest[:n]))
+			}
+		})
+	}
+}
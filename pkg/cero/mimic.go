@@ -0,0 +1,62 @@
+package cero
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// browser ClientHello fingerprints available for mimicking
+var mimicHellos = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"edge":    utls.HelloEdge_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"ios":     utls.HelloIOS_Auto,
+}
+
+// MimicBrowsers returns sorted names of browsers, which ClientHello can be presented
+func MimicBrowsers() []string {
+	browsers := make([]string, 0, len(mimicHellos))
+	for name := range mimicHellos {
+		browsers = append(browsers, name)
+	}
+	sort.Strings(browsers)
+	return browsers
+}
+
+/* performs TLS handshake over conn presenting browser-like ClientHello, returns its parameters */
+func handshakeMimic(ctx context.Context, conn net.Conn, serverName string, hello utls.ClientHelloID, opts *Options) (*handshakeState, error) {
+	var certRequested bool
+	config := &utls.Config{InsecureSkipVerify: true, ServerName: serverName, MinVersion: opts.MinVersion, MaxVersion: opts.MaxVersion}
+	config.GetClientCertificate = func(info *utls.CertificateRequestInfo) (*utls.Certificate, error) {
+		certRequested = true
+		for _, cert := range opts.Certificates {
+			cert := &utls.Certificate{Certificate: cert.Certificate, PrivateKey: cert.PrivateKey, Leaf: cert.Leaf}
+			if info.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+		return &utls.Certificate{}, nil
+	}
+
+	tlsConn := utls.UClient(conn, config, hello)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, handshakeError(err, certRequested)
+	}
+
+	state := tlsConn.ConnectionState()
+	chain, err := presentedChain(state.PeerCertificates)
+	if err != nil {
+		return nil, err
+	}
+	return &handshakeState{
+		chain:       chain,
+		version:     state.Version,
+		cipherSuite: state.CipherSuite,
+		alpn:        state.NegotiatedProtocol,
+		remoteAddr:  conn.RemoteAddr().String(),
+	}, nil
+}
@@ -0,0 +1,276 @@
+package cero
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+/* expands IP/IPv6 CIDR into atomic IPs
+returns channel from which string IPs must be consumed
+expansion stops (and channel is closed) when ctx is cancelled
+returns error if mask is too wide, or CIDR is not syntaxed properly
+supported masks:
+	- for IPv4: /[0-32] (whole IPv4 space)
+	- for IPv6: /[64-128]: (up to 2^64 IPs) */
+func ExpandCIDR(ctx context.Context, CIDR string) (chan string, error) {
+	return expandCIDR(ctx, CIDR, func(offset uint64) uint64 { return offset }, false)
+}
+
+// ExpandCIDRShuffled is like ExpandCIDR, but yields IPs in pseudo-random order,
+// determined by seed (the same seed gives the same order)
+func ExpandCIDRShuffled(ctx context.Context, CIDR string, seed uint64) (chan string, error) {
+	return expandCIDRShuffled(ctx, CIDR, seed, false)
+}
+
+// ExpandCIDRHosts is like ExpandCIDR, but omits network and broadcast addresses (the first and the last one)
+// of IPv4 CIDR, as they are rarely live. /31 and /32 are expanded whole, as well as IPv6 CIDRs
+func ExpandCIDRHosts(ctx context.Context, CIDR string) (chan string, error) {
+	return expandCIDR(ctx, CIDR, func(offset uint64) uint64 { return offset }, true)
+}
+
+// ExpandCIDRHostsShuffled is like ExpandCIDRHosts, but yields IPs in pseudo-random order (see ExpandCIDRShuffled)
+func ExpandCIDRHostsShuffled(ctx context.Context, CIDR string, seed uint64) (chan string, error) {
+	return expandCIDRShuffled(ctx, CIDR, seed, true)
+}
+
+func expandCIDRShuffled(ctx context.Context, CIDR string, seed uint64, hostsOnly bool) (chan string, error) {
+	_, ipnet, err := net.ParseCIDR(CIDR)
+	if err != nil {
+		return nil, err
+	}
+	ones, size := ipnet.Mask.Size()
+	return expandCIDR(ctx, CIDR, offsetPermutation(size-ones, seed), hostsOnly)
+}
+
+// expands CIDR, yielding IP at permute(offset) for every offset in the range.
+// if hostsOnly is set, network and broadcast addresses of IPv4 CIDR (wider than /31) are skipped
+func expandCIDR(ctx context.Context, CIDR string, permute func(offset uint64) uint64, hostsOnly bool) (chan string, error) {
+	// parse CIDR
+	_, ipnet, err := net.ParseCIDR(CIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	// general check for unsupported cases
+	mOnes, mBits := ipnet.Mask.Size()
+	if mBits == 128 && mOnes < 64 {
+		return nil, fmt.Errorf("%s: IPv6 mask is too wide, use one from range /[64-128]", CIDR)
+	}
+
+	// create channel to deliver output
+	outputChan := make(chan string)
+
+	// switch branch to IPv4 / IPv6
+	switch mBits {
+	case 32: // IPv4:
+		go func() {
+			// convert to uint32, for convenient bitwise operation
+			ip32 := binary.BigEndian.Uint32(ipnet.IP)
+			mask32 := binary.BigEndian.Uint32(ipnet.Mask)
+
+			// network and broadcast addresses are at the edges of the range
+			skipEdges := hostsOnly && ^mask32 >= 3
+
+			// IP is built in place, only its string is allocated
+			var ip [4]byte
+			for mask := uint32(0); mask <= ^mask32; mask++ {
+				offset := uint32(permute(uint64(mask)))
+				if skipEdges && (offset == 0 || offset == ^mask32) {
+					continue
+				}
+
+				// build IP as byte slice
+				binary.BigEndian.PutUint32(ip[:], ip32^offset)
+
+				// yield stringified IP
+				select {
+				case outputChan <- net.IP(ip[:]).String():
+				case <-ctx.Done():
+					close(outputChan)
+					return
+				}
+			}
+			close(outputChan)
+		}()
+
+	case 128: // IPv6
+		go func() {
+			// convert lower halves to uint64, for convenient bitwise operation
+			ip64 := binary.BigEndian.Uint64(ipnet.IP[8:])
+			mask64 := binary.BigEndian.Uint64(ipnet.Mask[8:])
+
+			// write portion of IP that will not change during expansion
+			var ip [16]byte
+			copy(ip[:8], ipnet.IP[:8])
+			for mask := uint64(0); mask <= ^mask64; mask++ {
+				// build IP as byte slice
+				binary.BigEndian.PutUint64(ip[8:], ip64^permute(mask))
+
+				// yield stringified IP
+				select {
+				case outputChan <- net.IP(ip[:]).String():
+				case <-ctx.Done():
+					close(outputChan)
+					return
+				}
+			}
+			close(outputChan)
+		}()
+	}
+	return outputChan, nil
+}
+
+// returns keyed permutation of k-bit offsets, that needs no memory to shuffle ranges of any size.
+// every step of a round (xor with key, xorshift, multiplication by odd constant modulo 2^k) is a bijection
+func offsetPermutation(k int, key uint64) func(offset uint64) uint64 {
+	mask := uint64(1)<<k - 1 // all ones for k = 64
+	shift := k/2 + 1
+	return func(x uint64) uint64 {
+		for round := 0; round < 3; round++ {
+			x = (x ^ key) & mask
+			x ^= x >> shift
+			x = (x * 0x9E3779B97F4A7C15) & mask
+			x ^= x >> shift
+		}
+		return x
+	}
+}
+
+/* every value with slash is condiered as CIDR
+if it's not a valid one, it will fail at later processing */
+func IsCIDR(value string) bool {
+	return strings.Contains(value, `/`)
+}
+
+var portRegexp, bracketRegexp *regexp.Regexp
+
+func init() {
+	portRegexp = regexp.MustCompile(`(?s)^(.*?)(:(\d+(-\d+)?))?$`)
+	bracketRegexp = regexp.MustCompile(`(?s)^\[.*\]$`)
+}
+
+/* parses input addr into -> host, port (might be a range of ports: 8000-8100).
+if port is not specified, returns ports as empty string.
+tolerates IPv6 port specification without enclosing IP into square brackets.
+in truly ambiguous cases for IPv6, treat as portless
+Doesn't check for errors, just splits, but guarantees for any input (see FuzzSplitHostPort):
+  - port is either empty, or a number or range of numbers (not checked to be within 1-65535)
+  - host and port recombine into addr: host[:port], or [host][:port] if brackets were stripped
+  - joining host and port back (with brackets for host with colons) splits into the same host and port
+*/
+func SplitHostPort(addr string) (host, port string) {
+	// split host and port
+	portMatch := portRegexp.FindStringSubmatch(addr)
+	host = portMatch[1]
+	port = portMatch[3]
+	isIPv6 := strings.Contains(host, `:`)
+
+	// skip further checks for bracketed IPv6
+	if isIPv6 && bracketRegexp.MatchString(host) {
+		host = strings.TrimPrefix(host, `[`)
+		host = strings.TrimSuffix(host, `]`)
+		return
+	}
+
+	// no port found, skip futher checks
+	if port == "" {
+		return
+	}
+
+	// skip futher checks for CIDR
+	if IsCIDR(host) {
+		return
+	}
+
+	// check ambiguous cases for IPv6
+	if isIPv6 {
+		// if port is longer than 4 digits -> it is truly a port
+		if len(port) > 4 {
+			return
+		}
+
+		// cancel port if whole thing parses as valid IPv6 (or range of them)
+		hostPort := fmt.Sprintf(`%s:%s`, host, port)
+		if net.ParseIP(hostPort) != nil || IsIPRange(hostPort) {
+			host, port = hostPort, ``
+			return
+		}
+	}
+	return
+}
+
+// IsDomainName checks if a string is a presentation-format domain name
+// (currently restricted to hostname-compatible "preferred name" LDH labels and
+func IsDomainName(s string) bool {
+	return isDomainName(s, false)
+}
+
+// IsServiceDomainName is like IsDomainName, but also allows underscore as the first character of a label,
+// as in names of service records (_dmarc.example.com, _acme-challenge.example.com)
+func IsServiceDomainName(s string) bool {
+	return isDomainName(s, true)
+}
+
+func isDomainName(s string, allowUnderscore bool) bool {
+	// See RFC 1035, RFC 3696.
+	// Presentation format has dots before every label except the first, and the
+	// terminal empty label is optional here because we assume fully-qualified
+	// (absolute) input. We must therefore reserve space for the first and last
+	// labels' length octets in wire format, where they are necessary and the
+	// maximum total length is 255.
+	// So our _effective_ maximum is 253, but 254 is not rejected if the last
+	// character is a dot.
+	l := len(s)
+	if l == 0 || l > 254 || l == 254 && s[l-1] != '.' {
+		return false
+	}
+
+	last := byte('.')
+	nonNumeric := false // true once we've seen a letter or hyphen
+	partlen := 0
+	parts := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		default:
+			return false
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			nonNumeric = true
+			partlen++
+		case '0' <= c && c <= '9':
+			// fine
+			partlen++
+		case c == '_' && allowUnderscore && last == '.':
+			// service label
+			nonNumeric = true
+			partlen++
+		case c == '-':
+			// Byte before dash cannot be dot.
+			if last == '.' {
+				return false
+			}
+			partlen++
+			nonNumeric = true
+		case c == '.':
+			// Byte before dot cannot be dot, dash.
+			if last == '.' || last == '-' {
+				return false
+			}
+			if partlen > 63 || partlen == 0 {
+				return false
+			}
+			partlen = 0
+			parts++
+		}
+		last = c
+	}
+	if last == '-' || partlen > 63 {
+		return false
+	}
+
+	return nonNumeric && (parts > 1 || parts > 0 && last != '.')
+}
@@ -0,0 +1,358 @@
+package cero
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const maxCount = 1000000
+
+func Test_expandCIDR(t *testing.T) {
+	type args struct {
+		CIDR string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"IPv4_32", args{CIDR: `192.168.1.1/32`}, false},
+		{"IPv4_30", args{CIDR: `192.168.1.13/30`}, false},
+		{"IPv4_16", args{CIDR: `192.168.1.17/16`}, false},
+		{"IPv4_12", args{CIDR: `192.15.1.17/12`}, false},
+		{"IPv4_0", args{CIDR: `192.15.1.17/1`}, false},
+		{"IPv6_128", args{CIDR: `ff:2:04::/128`}, false},
+		{"IPv6_115", args{CIDR: `0:f:2::14/115`}, false},
+		{"IPv6_64", args{CIDR: `0:f:2:4::/64`}, false},
+		{"too wide mask", args{CIDR: `0:f:2:4::/63`}, true},
+		{"too wide mask", args{CIDR: `0:f:2:4::/0`}, true},
+		{"invalid CIDR", args{CIDR: `0:f:2:4:/63`}, true},
+		{"invalid CIDR", args{CIDR: `[0:f:2:4::]/63`}, true},
+		{"invalid CIDR", args{CIDR: `127.0.0.1/63`}, true},
+		{"invalid CIDR", args{CIDR: `127..1/0`}, true},
+		{"not CIDR", args{CIDR: `::1`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCIDR(context.Background(), tt.args.CIDR)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("ExpandCIDR() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			// test number of IPs corresponds to mask CIDR size
+			// and all of those belong to the CIDR
+			var (
+				count int
+				ipnet *net.IPNet
+			)
+
+			for ip := range got {
+				count++
+				if count < 3 {
+					t.Log(ip)
+				}
+
+				_, ipnet, _ = net.ParseCIDR(tt.args.CIDR)
+				if !ipnet.Contains(net.ParseIP(ip)) {
+					t.Errorf("%s doesn't belong to CIDR", ip)
+					return
+				}
+
+				if count == maxCount {
+					break
+				}
+			}
+
+			// skip count check if exceeded test limit
+			if count == maxCount {
+				return
+			}
+
+			// check number of IPs is correct
+			mBits, mSize := ipnet.Mask.Size()
+			IPCount := 1 << (mSize - mBits)
+			if IPCount != count {
+				t.Errorf("Number of IPs is not right")
+			}
+
+			t.Logf("range fully tested")
+
+		})
+	}
+}
+
+func Test_expandCIDR_cancel(t *testing.T) {
+	for _, CIDR := range []string{`10.0.0.0/8`, `::/64`} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ips, err := ExpandCIDR(ctx, CIDR)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// consume single IP, then stop
+		<-ips
+		cancel()
+
+		// producer must close the channel and return, instead of blocking forever
+		done := make(chan struct{})
+		go func() {
+			for range ips {
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("%s: expansion did not stop after cancellation", CIDR)
+		}
+	}
+}
+
+func Test_expandCIDRShuffled(t *testing.T) {
+	for _, CIDR := range []string{`192.168.1.1/32`, `192.168.1.0/31`, `10.0.0.0/23`, `fe80::/117`} {
+		_, ipnet, _ := net.ParseCIDR(CIDR)
+		ones, size := ipnet.Mask.Size()
+
+		ips, err := ExpandCIDRShuffled(context.Background(), CIDR, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every IP of the CIDR must be yielded exactly once
+		seen := make(map[string]bool)
+		var got []string
+		for ip := range ips {
+			if seen[ip] || !ipnet.Contains(net.ParseIP(ip)) {
+				t.Fatalf("%s: unexpected IP %s", CIDR, ip)
+			}
+			seen[ip] = true
+			got = append(got, ip)
+		}
+		if len(got) != 1<<(size-ones) {
+			t.Fatalf("%s: got %d IPs", CIDR, len(got))
+		}
+
+		// large ranges must not come in ascending order
+		if len(got) > 16 && sort.SliceIsSorted(got, func(i, j int) bool {
+			return bytes.Compare(net.ParseIP(got[i]), net.ParseIP(got[j])) < 0
+		}) {
+			t.Errorf("%s: IPs are not shuffled", CIDR)
+		}
+	}
+}
+
+func Test_expandCIDRHosts(t *testing.T) {
+	tests := []struct {
+		CIDR    string
+		count   int
+		skipped []string // addresses, that must not be yielded
+	}{
+		{`10.0.0.0/24`, 254, []string{`10.0.0.0`, `10.0.0.255`}},
+		{`10.0.0.77/30`, 2, []string{`10.0.0.76`, `10.0.0.79`}},
+		// no-op for /31 and /32, and for IPv6
+		{`10.0.0.0/31`, 2, nil},
+		{`10.0.0.1/32`, 1, nil},
+		{`fe80::/120`, 256, nil},
+	}
+	for _, tt := range tests {
+		plain, err := ExpandCIDRHosts(context.Background(), tt.CIDR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shuffled, err := ExpandCIDRHostsShuffled(context.Background(), tt.CIDR, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ips := range []chan string{plain, shuffled} {
+			var got []string
+			for ip := range ips {
+				got = append(got, ip)
+			}
+			assert.Len(t, got, tt.count, tt.CIDR)
+			for _, ip := range tt.skipped {
+				assert.NotContains(t, got, ip, tt.CIDR)
+			}
+		}
+	}
+}
+
+func Benchmark_expandCIDR(b *testing.B) {
+	for _, CIDR := range []string{"10.0.0.0/16", "2001:db8::/112"} {
+		b.Run(CIDR, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ips, err := ExpandCIDR(context.Background(), CIDR)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for range ips {
+				}
+			}
+		})
+	}
+}
+
+func Test_offsetPermutation(t *testing.T) {
+	// permutation of the whole 64-bit space can not be checked exhaustively, check that it is keyed and deterministic
+	p1, p2 := offsetPermutation(64, 1), offsetPermutation(64, 2)
+	assert.Equal(t, p1(12345), offsetPermutation(64, 1)(12345))
+	assert.NotEqual(t, p1(12345), p2(12345))
+}
+
+func Test_splitHostPort(t *testing.T) {
+	type args struct {
+		addr string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantHost string
+		wantPort string
+	}{
+		{`Initial input`, args{addr: ``}, ``, ``},
+		{`Portless IPv4`, args{addr: `1.1.1.1`}, `1.1.1.1`, ``},
+		{`Portfull IPv4`, args{addr: `1.1.1.1:443`}, `1.1.1.1`, `443`},
+		{`Portless IPv4 CIDR`, args{addr: `1.1.1.1/32`}, `1.1.1.1/32`, ``},
+		{`Portfull IPv4 CIDR`, args{addr: `1.1.1.1/32:443`}, `1.1.1.1/32`, `443`},
+		{`Portless IPv6`, args{addr: `::1`}, `::1`, ``},
+		{`Ambiguous port IPv6`, args{addr: `::1:443`}, `::1:443`, ``},
+		{`Bracket IPv6 with port`, args{addr: `[::1]:443`}, `::1`, `443`},
+		{`Wrong bracket port IPv6`, args{addr: `::1]:443`}, `::1]`, `443`},
+		{`Unambiguous port IPv6`, args{addr: `::1:44300`}, `::1`, `44300`},
+		{`Unambiguous port IPv6`, args{addr: `::1:44300`}, `::1`, `44300`},
+		{`Unambiguous port IPv6`, args{addr: `1:1:1:1:1:1:1:1:80`}, `1:1:1:1:1:1:1:1`, `80`},
+		{`ambiguous port IPv6`, args{addr: `1:1:1:1:1:1:1:80`}, `1:1:1:1:1:1:1:80`, ``},
+		{`Portless IPv6 CIDR`, args{addr: `::1/64`}, `::1/64`, ``},
+		{`Portfull IPv6 CIDR`, args{addr: `::1/64:443`}, `::1/64`, `443`},
+		{`Bracket IPv6 CIDR`, args{addr: `[2001:db8::/64]`}, `2001:db8::/64`, ``},
+		{`Bracket IPv6 CIDR with port`, args{addr: `[2001:db8::/64]:443`}, `2001:db8::/64`, `443`},
+		{`Bracket IPv6 CIDR with port range`, args{addr: `[::1/64]:8000-8100`}, `::1/64`, `8000-8100`},
+		{`Port range IPv4`, args{addr: `1.1.1.1:8000-8100`}, `1.1.1.1`, `8000-8100`},
+		{`Port range IPv4 CIDR`, args{addr: `1.1.1.1/32:8000-8100`}, `1.1.1.1/32`, `8000-8100`},
+		{`Port range domain`, args{addr: `example.com:1-5`}, `example.com`, `1-5`},
+		{`Port range bracket IPv6`, args{addr: `[::1]:1-5`}, `::1`, `1-5`},
+		{`Unambiguous port range IPv6`, args{addr: `::1:8000-8100`}, `::1`, `8000-8100`},
+		{`Portless IPv4 range`, args{addr: `10.0.0.1-254`}, `10.0.0.1-254`, ``},
+		{`Portless IPv6 range`, args{addr: `2001:db8::10-2001:db8::20`}, `2001:db8::10-2001:db8::20`, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHost, gotPort := SplitHostPort(tt.args.addr)
+			if gotHost != tt.wantHost {
+				t.Errorf("SplitHostPort() gotHost = %v, want %v", gotHost, tt.wantHost)
+			}
+			if gotPort != tt.wantPort {
+				t.Errorf("SplitHostPort() gotPort = %v, want %v", gotPort, tt.wantPort)
+			}
+		})
+	}
+}
+
+func FuzzSplitHostPort(f *testing.F) {
+	for _, addr := range []string{
+		``, `1.1.1.1:443`, `1.1.1.1/32:8000-8100`, `::1:443`, `[::1]:443`, `::1]:443`, `::1:44300`,
+		`[2001:db8::/64]:443`, `2001:db8::10-2001:db8::20`, `example.com:`, `[example.com]`, `a@b@c:1`, "example.com\n:443",
+	} {
+		f.Add(addr)
+	}
+	portRegexp := regexp.MustCompile(`^\d+(-\d+)?$`)
+
+	f.Fuzz(func(t *testing.T, addr string) {
+		host, port := SplitHostPort(addr)
+
+		// port is either absent, or a number (or range of them)
+		if port != "" && !portRegexp.MatchString(port) {
+			t.Fatalf("%q: invalid port %q", addr, port)
+		}
+
+		// host and port recombine into input (host might have been enclosed in brackets)
+		recombined := map[string]bool{host: true, "[" + host + "]": true}
+		if port != "" {
+			recombined = map[string]bool{host + ":" + port: true, "[" + host + "]:" + port: true}
+		}
+		if !recombined[addr] {
+			t.Fatalf("%q: split into %q and %q", addr, host, port)
+		}
+
+		// split of joined host and port is stable
+		if port != "" {
+			joined := host + ":" + port
+			if strings.Contains(host, ":") {
+				joined = "[" + host + "]:" + port
+			}
+			if h, p := SplitHostPort(joined); h != host || p != port {
+				t.Fatalf("%q: split into %q and %q, but %q splits into %q and %q", addr, host, port, joined, h, p)
+			}
+		}
+	})
+}
+
+func Test_isDomainName(t *testing.T) {
+	cases := []struct {
+		host     string
+		expected bool
+	}{
+		// -- valid
+		{"test.com.ru", true},
+		{"test-1.com", true},
+		{"1.1.1.com", true},
+		{"test.com.", true}, // yes trailing dot is allowed by RFC
+
+		// -- invalid
+		{"127.0.0.1", false},
+		{"test", false},  // single level
+		{"test.", false}, // single level
+		{"test_test.com", false},
+		{".test", false},
+		{"*.test.com", false},
+		{"test-.com", false},
+		{"te!st.com", false},
+		{"!.dot.com", false},
+	}
+
+	for _, c := range cases {
+		actual := IsDomainName(c.host)
+		if actual != c.expected {
+			t.Errorf("IsDomainName(%s) expected to be %v", c.host, c.expected)
+		}
+	}
+}
+
+func Test_isDomainName_underscore(t *testing.T) {
+	cases := []struct {
+		host     string
+		expected bool
+	}{
+		{"_dmarc.example.com", true},
+		{"_acme-challenge.www.example.com", true},
+		{"_sip._tcp.example.com", true},
+		{"example.com", true},
+
+		{"d_marc.example.com", false}, // only first character of a label
+		{"_", false},                  // single level
+		{"*._dmarc.example.com", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, IsServiceDomainName(c.host), c.host)
+	}
+
+	// strict by default
+	assert.False(t, IsDomainName("_dmarc.example.com"))
+
+	assert.True(t, isDomainNameIDN("_dmarc.пример.рф", true))
+	assert.False(t, isDomainNameIDN("_dmarc.пример.рф", false))
+}
@@ -0,0 +1,51 @@
+package cero
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePorts parses comma-separated list of ports and ranges of ports (443,8443,9000-9100) into list of ports.
+// every port must be a number within 1-65535
+func ParsePorts(spec string) ([]string, error) {
+	var ports []string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		startStr, endStr, isRange := strings.Cut(item, "-")
+		if !isRange {
+			port, err := parsePortNumber(item)
+			if err != nil {
+				return nil, err
+			}
+			ports = append(ports, strconv.Itoa(port))
+			continue
+		}
+
+		start, err := parsePortNumber(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid start of port range", item)
+		}
+		end, err := parsePortNumber(endStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid end of port range", item)
+		}
+		if start > end {
+			return nil, fmt.Errorf("%s: start of port range is after its end", item)
+		}
+
+		for port := start; port <= end; port++ {
+			ports = append(ports, strconv.Itoa(port))
+		}
+	}
+	return ports, nil
+}
+
+// parses port number, that must be within 1-65535
+func parsePortNumber(port string) (int, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port: %q (must be a number within 1-65535)", port)
+	}
+	return n, nil
+}
@@ -0,0 +1,41 @@
+package cero
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePorts(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected []string
+		err      string
+	}{
+		{"443", []string{"443"}, ""},
+		{"443,8443", []string{"443", "8443"}, ""},
+		{"440-443", []string{"440", "441", "442", "443"}, ""},
+		{"443, 8443,9000-9002", []string{"443", "8443", "9000", "9001", "9002"}, ""},
+		{"65535-65535", []string{"65535"}, ""},
+		{"450-440", nil, "450-440: start of port range is after its end"},
+		{"0-10", nil, "0-10: invalid start of port range"},
+		{"1-70000", nil, "1-70000: invalid end of port range"},
+		{"a-10", nil, "a-10: invalid start of port range"},
+		{"10-", nil, "10-: invalid end of port range"},
+		{"0443", []string{"443"}, ""},
+		{"99999", nil, `invalid port: "99999" (must be a number within 1-65535)`},
+		{"0", nil, `invalid port: "0" (must be a number within 1-65535)`},
+		{"443,abc", nil, `invalid port: "abc" (must be a number within 1-65535)`},
+		{"", nil, `invalid port: "" (must be a number within 1-65535)`},
+	}
+
+	for _, c := range cases {
+		ports, err := ParsePorts(c.spec)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.spec)
+			continue
+		}
+		assert.NoError(t, err, c.spec)
+		assert.Equal(t, c.expected, ports, c.spec)
+	}
+}
@@ -0,0 +1,42 @@
+package cero
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+)
+
+// minimal sizes of keys (in bits), that are not considered weak
+const (
+	minRSABits   = 2048
+	minECDSABits = 224
+)
+
+// returns size of public key in bits (size of curve for ECDSA), zero if key is of unknown type.
+// size of DSA keys is not reported (crypto/dsa is deprecated), they are weak anyway
+func publicKeyBits(pub any) int {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+// IsWeakKey reports whether public key of algorithm and size (see Result.PublicKeyBits) is weak:
+// RSA shorter than 2048 bits, ECDSA on curve smaller than 224 bits, or DSA of any size
+func IsWeakKey(alg x509.PublicKeyAlgorithm, bits int) bool {
+	switch alg {
+	case x509.RSA:
+		return bits < minRSABits
+	case x509.ECDSA:
+		return bits < minECDSABits
+	case x509.DSA:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package cero
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_publicKeyBits(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1024, publicKeyBits(&rsaKey.PublicKey))
+
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, curve.Params().BitSize, publicKeyBits(&key.PublicKey))
+	}
+
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 256, publicKeyBits(edKey))
+
+	assert.Zero(t, publicKeyBits(nil))
+}
+
+func TestIsWeakKey(t *testing.T) {
+	cases := []struct {
+		alg  x509.PublicKeyAlgorithm
+		bits int
+		weak bool
+	}{
+		{x509.RSA, 1024, true},
+		{x509.RSA, 2047, true},
+		{x509.RSA, 2048, false},
+		{x509.RSA, 4096, false},
+		{x509.ECDSA, 192, true},
+		{x509.ECDSA, 224, false},
+		{x509.ECDSA, 256, false},
+		{x509.DSA, 2048, true},
+		{x509.Ed25519, 256, false},
+		{x509.UnknownPublicKeyAlgorithm, 0, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.weak, IsWeakKey(c.alg, c.bits), "%s %d", c.alg, c.bits)
+	}
+}
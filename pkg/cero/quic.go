@@ -0,0 +1,108 @@
+package cero
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+
+	"github.com/quic-go/quic-go"
+)
+
+// application protocol to advertise over QUIC, unless Options.ALPN is set (QUIC handshake requires one)
+const quicDefaultALPN = "h3"
+
+// connects to addr over UDP and grabs certificate chain presented during QUIC handshake.
+// serverName is sent as SNI (if not empty)
+func grabChainQUIC(ctx context.Context, addr, serverName string, opts *Options) (*handshakeState, error) {
+	// timeout covers resolution and the whole handshake (there is no connection to dial)
+	timeout := opts.HandshakeTimeout
+	if timeout == 0 {
+		timeout = opts.Timeout
+	}
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	remote, err := resolveUDPAddr(ctx, addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	var local *net.UDPAddr
+	if opts.LocalAddr != nil {
+		local = &net.UDPAddr{IP: opts.LocalAddr.IP, Zone: opts.LocalAddr.Zone}
+	}
+	packetConn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+	defer packetConn.Close()
+
+	alpn := opts.ALPN
+	if len(alpn) == 0 {
+		alpn = []string{quicDefaultALPN}
+	}
+
+	var certRequested bool
+	conn, err := quic.Dial(ctx, packetConn, remote, &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         serverName,
+		NextProtos:         alpn,
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certRequested = true
+			return clientCertificate(info, opts.Certificates), nil
+		},
+	}, &quic.Config{HandshakeIdleTimeout: timeout})
+	if err != nil {
+		return nil, handshakeError(err, certRequested)
+	}
+	defer conn.CloseWithError(0, "")
+
+	state := conn.ConnectionState().TLS
+	chain, err := presentedChain(state.PeerCertificates)
+	if err != nil {
+		return nil, err
+	}
+	return &handshakeState{
+		chain:       chain,
+		version:     state.Version,
+		cipherSuite: state.CipherSuite,
+		alpn:        state.NegotiatedProtocol,
+		remoteAddr:  remote.String(),
+	}, nil
+}
+
+// resolves addr (host:port) to UDP address: domain name is looked up with Options.LookupIPAddr,
+// or with Options.Resolver, and the first of its IPs is taken
+func resolveUDPAddr(ctx context.Context, addr string, opts *Options) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	lookup := opts.LookupIPAddr
+	if lookup == nil {
+		resolver := opts.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookup = resolver.LookupIPAddr
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return &net.UDPAddr{IP: addrs[0].IP, Zone: addrs[0].Zone, Port: port}, nil
+}
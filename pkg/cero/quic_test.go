@@ -0,0 +1,86 @@
+package cero
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper utility to start QUIC server with certificate for example.com, accepting connections until closed
+func newTestQUICServer(t *testing.T, protocols ...string) *quic.Listener {
+	cert, key := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com", "www.example.com"}}, nil, nil)
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		NextProtos:   protocols,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				<-conn.Context().Done()
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestGrabCert_QUIC(t *testing.T) {
+	listener := newTestQUICServer(t, "h3", "doq")
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	// h3 is advertised by default
+	result, err := GrabCert(context.Background(), addr, &Options{QUIC: true, Timeout: 2 * time.Second})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"example.com", "www.example.com"}, result.Names)
+		assert.EqualValues(t, tls.VersionTLS13, result.Version)
+		assert.Equal(t, "h3", result.ALPN)
+		assert.Equal(t, addr, result.RemoteAddr)
+	}
+
+	result, err = GrabCert(context.Background(), addr, &Options{QUIC: true, ALPN: []string{"doq"}, Timeout: 2 * time.Second})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "doq", result.ALPN)
+	}
+
+	// domain name is dialed at its IP, and sent as SNI
+	_, port, _ := net.SplitHostPort(addr)
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	result, err = GrabCert(context.Background(), net.JoinHostPort("www.example.com", port), &Options{QUIC: true, LookupIPAddr: lookup, Timeout: 2 * time.Second})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "www.example.com", result.Hostname)
+		assert.True(t, result.HostnameMatch)
+	}
+
+	// nobody answers
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packetConn.Close()
+
+	_, err = GrabCert(context.Background(), packetConn.LocalAddr().String(), &Options{QUIC: true, Timeout: 200 * time.Millisecond})
+	assert.Equal(t, ClassTimeout, ClassifyError(err), err)
+}
+
+func TestOptions_Validate_QUIC(t *testing.T) {
+	assert.NoError(t, (&Options{QUIC: true}).Validate())
+	assert.Error(t, (&Options{QUIC: true, STARTTLS: "smtp"}).Validate())
+	assert.Error(t, (&Options{QUIC: true, Mimic: "chrome"}).Validate())
+	assert.Error(t, (&Options{QUIC: true, MaxVersion: tls.VersionTLS12}).Validate())
+}
@@ -0,0 +1,81 @@
+package cero
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// NewResolver returns resolver, that queries specified DNS servers (host:port, port 53 if omitted) instead of system ones.
+// servers are used in order of failover: queries go to the same server, until it fails to answer one of them
+func NewResolver(servers []string) (*net.Resolver, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers specified")
+	}
+
+	d := &failoverDialer{servers: make([]string, len(servers))}
+	for i, server := range servers {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			// port omitted
+			host, port = server, "53"
+		}
+		if host == "" || net.ParseIP(host) == nil && !IsDomainName(host) {
+			return nil, fmt.Errorf("%s: invalid DNS server address", server)
+		}
+		if _, err := parsePortNumber(port); err != nil {
+			return nil, fmt.Errorf("%s: %w", server, err)
+		}
+		d.servers[i] = net.JoinHostPort(host, port)
+	}
+	return &net.Resolver{PreferGo: true, Dial: d.dial}, nil
+}
+
+// dials DNS server currently in use, moving to the next one once it fails
+type failoverDialer struct {
+	servers []string
+	current uint32 // index of server in use (modulo number of servers)
+}
+
+// dials server in use, regardless of address (of system DNS server), that resolver asks for
+func (d *failoverDialer) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	current := atomic.LoadUint32(&d.current)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.servers[current%uint32(len(d.servers))])
+	if err != nil {
+		d.fail(current)
+		return nil, err
+	}
+	fc := failoverConn{Conn: conn, fail: func() { d.fail(current) }}
+
+	// resolver tells datagram connections from stream ones by this interface
+	if pc, ok := conn.(net.PacketConn); ok {
+		return &failoverPacketConn{failoverConn: fc, PacketConn: pc}, nil
+	}
+	return &fc, nil
+}
+
+// moves to the next server, unless it was already done after failure of the same server
+func (d *failoverDialer) fail(current uint32) {
+	atomic.CompareAndSwapUint32(&d.current, current, current+1)
+}
+
+// connection to DNS server, that reports failure to receive answer
+type failoverConn struct {
+	net.Conn
+	fail func()
+}
+
+func (c *failoverConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.fail()
+	}
+	return n, err
+}
+
+type failoverPacketConn struct {
+	failoverConn
+	net.PacketConn
+}
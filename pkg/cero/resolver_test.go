@@ -0,0 +1,175 @@
+package cero
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// starts DNS server (over UDP), that answers queries with records of zone (see testDNSAnswer). returns address of server
+func newTestDNSServer(t *testing.T, zone map[string]string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if answer, err := testDNSAnswer(buf[:n], zone); err == nil {
+				conn.WriteTo(answer, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// answers A queries with records of zone (name -> IPv4). other queries get empty answer (with SOA record), unknown names get NXDOMAIN
+func testDNSAnswer(query []byte, zone map[string]string) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, err
+	}
+	if len(msg.Questions) != 1 {
+		return nil, errors.New("expected single question")
+	}
+	question := msg.Questions[0]
+
+	answer := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.ID, Response: true, Authoritative: true},
+		Questions: msg.Questions,
+	}
+	ip, ok := zone[question.Name.String()]
+	switch {
+	case !ok:
+		answer.RCode = dnsmessage.RCodeNameError
+	case question.Type == dnsmessage.TypeA:
+		var a dnsmessage.AResource
+		copy(a.A[:], net.ParseIP(ip).To4())
+		answer.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &a,
+		}}
+	default:
+		answer.Authorities = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.SOAResource{NS: question.Name, MBox: question.Name, MinTTL: 60},
+		}}
+	}
+	return answer.Pack()
+}
+
+// returns address of UDP port, that is closed
+func closedUDPAddr(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func TestNewResolver(t *testing.T) {
+	server := newTestDNSServer(t, map[string]string{"example.test.": "127.0.0.2"})
+
+	resolver, err := NewResolver([]string{server})
+	assert.NoError(t, err)
+
+	addrs, err := resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, addrs)
+
+	// unknown names are not found
+	_, err = resolver.LookupHost(context.Background(), "unknown.test")
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+
+	// failed server is replaced by the next one
+	resolver, err = NewResolver([]string{closedUDPAddr(t), server})
+	assert.NoError(t, err)
+
+	addrs, err = resolver.LookupHost(context.Background(), "example.test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, addrs)
+
+	// invalid addresses
+	for _, server := range []string{"", ":53", "127.0.0.1:0", "127.0.0.1:dns", "-invalid-"} {
+		_, err := NewResolver([]string{server})
+		assert.Error(t, err, server)
+	}
+	_, err = NewResolver(nil)
+	assert.Error(t, err)
+
+	// port is optional
+	_, err = NewResolver([]string{"8.8.8.8", "dns.example.com", "[2001:4860:4860::8888]:53"})
+	assert.NoError(t, err)
+}
+
+func TestGrabCert_resolver(t *testing.T) {
+	server := newTestDNSServer(t, map[string]string{"example.test.": "127.0.0.1"})
+	resolver, err := NewResolver([]string{server})
+	assert.NoError(t, err)
+
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// name is resolved by specified server, and dialed
+	result, err := GrabCert(context.Background(), net.JoinHostPort("example.test", tsURL.Port()), &Options{Timeout: time.Second, Resolver: resolver})
+	if assert.NoError(t, err) {
+		assert.Equal(t, ts.Certificate().Raw, result.Chain[0].Raw)
+	}
+
+	_, err = GrabCert(context.Background(), net.JoinHostPort("unknown.test", tsURL.Port()), &Options{Timeout: time.Second, Resolver: resolver})
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+}
+
+func TestGrabCert_lookupIPAddr(t *testing.T) {
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IPs are dialed in turn, until connection succeeds (server listens only on the last one)
+	var lookups []string
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups = append(lookups, host)
+		if host != "example.test" {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	result, err := GrabCert(context.Background(), net.JoinHostPort("example.test", tsURL.Port()), &Options{Timeout: time.Second, LookupIPAddr: lookup})
+	if assert.NoError(t, err) {
+		assert.Equal(t, ts.Certificate().Raw, result.Chain[0].Raw)
+		assert.Equal(t, tsURL.Host, result.RemoteAddr)
+	}
+
+	_, err = GrabCert(context.Background(), net.JoinHostPort("unknown.test", tsURL.Port()), &Options{Timeout: time.Second, LookupIPAddr: lookup})
+	assert.Equal(t, ClassDNS, ClassifyError(err))
+
+	// IPs are not looked up
+	_, err = GrabCert(context.Background(), tsURL.Host, &Options{Timeout: time.Second, LookupIPAddr: lookup})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.test", "unknown.test"}, lookups)
+}
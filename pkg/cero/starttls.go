@@ -0,0 +1,238 @@
+package cero
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// negotiates TLS over plaintext connection, using STARTTLS command of the protocol.
+// when negotiate returns without error, conn is ready for TLS handshake.
+// domain is the name of service (SNI, or host dialed), for protocols that address it.
+// deadline of the whole negotiation is set on conn by caller
+type starttlsNegotiator interface {
+	negotiate(conn net.Conn, domain string) error
+	defaultPort() string
+}
+
+// supported STARTTLS protocols
+var starttlsNegotiators = map[string]starttlsNegotiator{
+	"smtp":     smtpNegotiator{},
+	"xmpp":     xmppNegotiator{},
+	"ftp":      ftpNegotiator{},
+	"imap":     imapNegotiator{},
+	"ldap":     ldapNegotiator{},
+	"pop3":     pop3Negotiator{},
+	"postgres": postgresNegotiator{},
+}
+
+// STARTTLS protocols of well-known ports, negotiated with Options.AutoSTARTTLS
+var starttlsPorts = map[string]string{
+	"21":   "ftp",
+	"25":   "smtp",
+	"587":  "smtp",
+	"110":  "pop3",
+	"143":  "imap",
+	"389":  "ldap",
+	"5222": "xmpp",
+	"5432": "postgres",
+}
+
+// returns negotiator to run before TLS handshake with addr (host:port), false for plain TLS.
+// with AutoSTARTTLS, protocol is chosen by port
+func starttlsNegotiatorFor(addr string, opts *Options) (starttlsNegotiator, bool) {
+	protocol := opts.STARTTLS
+	if opts.AutoSTARTTLS {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, false
+		}
+		protocol = starttlsPorts[port]
+	}
+	negotiator, ok := starttlsNegotiators[protocol]
+	return negotiator, ok
+}
+
+// STARTTLSProtocols returns sorted names of supported STARTTLS protocols
+func STARTTLSProtocols() []string {
+	protocols := make([]string, 0, len(starttlsNegotiators))
+	for name := range starttlsNegotiators {
+		protocols = append(protocols, name)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// STARTTLSDefaultPort returns default port of STARTTLS protocol, false if protocol is not supported
+func STARTTLSDefaultPort(protocol string) (string, bool) {
+	negotiator, ok := starttlsNegotiators[protocol]
+	if !ok {
+		return "", false
+	}
+	return negotiator.defaultPort(), true
+}
+
+// runs STARTTLS negotiation over conn, interrupting it when ctx is cancelled
+func negotiateContext(ctx context.Context, conn net.Conn, negotiator starttlsNegotiator, domain string) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock pending reads and writes
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err := negotiator.negotiate(conn, domain)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// SMTP (RFC 3207): greeting, EHLO, STARTTLS
+type smtpNegotiator struct{}
+
+func (smtpNegotiator) defaultPort() string { return "587" }
+
+func (smtpNegotiator) negotiate(conn net.Conn, _ string) error {
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	if _, _, err := r.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "EHLO cero\r\n"); err != nil {
+		return err
+	}
+	if _, _, err := r.ReadResponse(250); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	_, _, err := r.ReadResponse(220)
+	return err
+}
+
+// IMAP (RFC 2595): greeting, tagged STARTTLS command
+type imapNegotiator struct{}
+
+func (imapNegotiator) defaultPort() string { return "143" }
+
+func (imapNegotiator) negotiate(conn net.Conn, _ string) error {
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	greeting, err := r.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("imap: unexpected greeting: %s", greeting)
+	}
+
+	if _, err := fmt.Fprintf(conn, "a001 STARTTLS\r\n"); err != nil {
+		return err
+	}
+
+	// skip untagged responses, until tagged completion
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("imap: STARTTLS refused: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+// FTP (RFC 4217): banner, AUTH TLS command
+type ftpNegotiator struct{}
+
+func (ftpNegotiator) defaultPort() string { return "21" }
+
+func (ftpNegotiator) negotiate(conn net.Conn, _ string) error {
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	if _, _, err := r.ReadResponse(220); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "AUTH TLS\r\n"); err != nil {
+		return err
+	}
+	_, _, err := r.ReadResponse(234)
+	return err
+}
+
+// POP3 (RFC 2595): greeting, STLS command
+type pop3Negotiator struct{}
+
+func (pop3Negotiator) defaultPort() string { return "110" }
+
+func (pop3Negotiator) negotiate(conn net.Conn, _ string) error {
+	r := textproto.NewReader(bufio.NewReader(conn))
+
+	greeting, err := r.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("pop3: unexpected greeting: %s", greeting)
+	}
+
+	if _, err := fmt.Fprintf(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+
+	reply, err := r.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "+OK") {
+		return fmt.Errorf("pop3: STLS refused: %s", reply)
+	}
+	return nil
+}
+
+// SSLRequest message of PostgreSQL protocol: length (8) and request code (80877103)
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xD2, 0x16, 0x2F}
+
+// PostgreSQL: SSLRequest, single byte reply ('S' - proceed with TLS, 'N' - refused)
+type postgresNegotiator struct{}
+
+func (postgresNegotiator) defaultPort() string { return "5432" }
+
+func (postgresNegotiator) negotiate(conn net.Conn, _ string) error {
+	if _, err := conn.Write(postgresSSLRequest); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	switch reply[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return errors.New("postgres: server does not support TLS")
+	}
+	return fmt.Errorf("postgres: unexpected reply to SSLRequest: %q", reply[0])
+}
@@ -0,0 +1,102 @@
+package cero
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fake connection: reads scripted server output, records client writes
+type fakeConn struct {
+	net.Conn
+	server  io.Reader
+	written bytes.Buffer
+}
+
+func (c *fakeConn) Read(b []byte) (int, error)  { return c.server.Read(b) }
+func (c *fakeConn) Write(b []byte) (int, error) { return c.written.Write(b) }
+
+func Test_starttlsNegotiators(t *testing.T) {
+	tests := []struct {
+		name        string
+		protocol    string
+		server      string
+		wantWritten string
+		wantErr     bool
+	}{
+		{"smtp", "smtp", "220 ESMTP\r\n250-mail\r\n250 STARTTLS\r\n220 Ready\r\n", "EHLO cero\r\nSTARTTLS\r\n", false},
+		{"smtp refused", "smtp", "220 ESMTP\r\n250 mail\r\n454 TLS not available\r\n", "EHLO cero\r\nSTARTTLS\r\n", true},
+		{"smtp bad greeting", "smtp", "554 go away\r\n", "", true},
+		{"smtp closed", "smtp", "220 ESMTP\r\n", "EHLO cero\r\n", true},
+		{"imap", "imap", "* OK ready\r\n* CAPABILITY IMAP4rev1\r\na001 OK go\r\n", "a001 STARTTLS\r\n", false},
+		{"imap refused", "imap", "* OK ready\r\na001 NO no TLS\r\n", "a001 STARTTLS\r\n", true},
+		{"imap bad greeting", "imap", "* BYE\r\n", "", true},
+		{"ftp", "ftp", "220-welcome\r\n220 FTP ready\r\n234 AUTH TLS OK\r\n", "AUTH TLS\r\n", false},
+		{"ftp refused", "ftp", "220 FTP ready\r\n500 AUTH not understood\r\n", "AUTH TLS\r\n", true},
+		{"ftp closed", "ftp", "220 FTP ready\r\n", "AUTH TLS\r\n", true},
+		{"pop3", "pop3", "+OK POP3 ready\r\n+OK begin TLS\r\n", "STLS\r\n", false},
+		{"pop3 refused", "pop3", "+OK POP3 ready\r\n-ERR command not supported\r\n", "STLS\r\n", true},
+		{"pop3 bad greeting", "pop3", "-ERR busy\r\n", "", true},
+		{"postgres", "postgres", "S", string(postgresSSLRequest), false},
+		{"postgres refused", "postgres", "N", string(postgresSSLRequest), true},
+		{"postgres garbage", "postgres", "E", string(postgresSSLRequest), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{server: strings.NewReader(tt.server)}
+			err := starttlsNegotiators[tt.protocol].negotiate(conn, "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("negotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantWritten, conn.written.String())
+		})
+	}
+}
+
+func Test_negotiateContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// server never greets, negotiation is stuck until cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := negotiateContext(ctx, client, smtpNegotiator{}, "example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_starttlsNegotiatorFor(t *testing.T) {
+	tests := []struct {
+		addr string
+		opts Options
+		want starttlsNegotiator
+	}{
+		{"example.com:25", Options{}, nil},
+		{"example.com:25", Options{STARTTLS: "imap"}, imapNegotiator{}},
+		{"example.com:25", Options{AutoSTARTTLS: true}, smtpNegotiator{}},
+		{"example.com:587", Options{AutoSTARTTLS: true}, smtpNegotiator{}},
+		{"example.com:143", Options{AutoSTARTTLS: true}, imapNegotiator{}},
+		{"example.com:110", Options{AutoSTARTTLS: true}, pop3Negotiator{}},
+		{"example.com:21", Options{AutoSTARTTLS: true}, ftpNegotiator{}},
+		{"example.com:5222", Options{AutoSTARTTLS: true}, xmppNegotiator{}},
+		{"example.com:389", Options{AutoSTARTTLS: true}, ldapNegotiator{}},
+		{"[::1]:5432", Options{AutoSTARTTLS: true}, postgresNegotiator{}},
+		{"example.com:443", Options{AutoSTARTTLS: true}, nil},
+		{"example.com:8443", Options{AutoSTARTTLS: true}, nil},
+	}
+	for _, tt := range tests {
+		negotiator, ok := starttlsNegotiatorFor(tt.addr, &tt.opts)
+		assert.Equal(t, tt.want, negotiator, tt.addr)
+		assert.Equal(t, tt.want != nil, ok, tt.addr)
+	}
+
+	assert.Error(t, (&Options{STARTTLS: "smtp", AutoSTARTTLS: true}).Validate())
+	assert.Error(t, (&Options{QUIC: true, AutoSTARTTLS: true}).Validate())
+}
@@ -0,0 +1,43 @@
+package cero
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// TLS versions, by their short names
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion parses short name of TLS version (1.0, 1.1, 1.2 or 1.3) into its code
+func ParseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version: %s (use 1.0, 1.1, 1.2 or 1.3)", name)
+	}
+	return version, nil
+}
+
+// reports whether version is one of supported TLS versions
+func isTLSVersion(version uint16) bool {
+	for _, code := range tlsVersions {
+		if code == version {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSVersionName returns human-readable name of TLS version code: TLS 1.2
+func TLSVersionName(version uint16) string {
+	for name, code := range tlsVersions {
+		if code == version {
+			return "TLS " + name
+		}
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
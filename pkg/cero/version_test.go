@@ -0,0 +1,27 @@
+package cero
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	for name, expected := range map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	} {
+		version, err := ParseTLSVersion(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, version)
+		assert.Equal(t, "TLS "+name, TLSVersionName(version))
+	}
+
+	_, err := ParseTLSVersion("1.4")
+	assert.EqualError(t, err, "unsupported TLS version: 1.4 (use 1.0, 1.1, 1.2 or 1.3)")
+
+	assert.Equal(t, "0x0300", TLSVersionName(0x0300))
+}
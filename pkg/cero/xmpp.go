@@ -0,0 +1,106 @@
+package cero
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// XML namespaces of XMPP streams and STARTTLS feature
+const (
+	xmppStreamNS = "http://etherx.jabber.org/streams"
+	xmppTLSNS    = "urn:ietf:params:xml:ns:xmpp-tls"
+)
+
+// XMPP (RFC 6120): opening stream header, stream features with STARTTLS, starttls command, proceed
+type xmppNegotiator struct{}
+
+func (xmppNegotiator) defaultPort() string { return "5222" }
+
+func (xmppNegotiator) negotiate(conn net.Conn, domain string) error {
+	if _, err := io.WriteString(conn, xmppStreamHeader(domain)); err != nil {
+		return err
+	}
+
+	d := xml.NewDecoder(conn)
+	if err := readXMPPFeatures(d); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "<starttls xmlns='%s'/>", xmppTLSNS); err != nil {
+		return err
+	}
+	return readXMPPProceed(d)
+}
+
+// returns opening header of client stream, addressed to domain
+func xmppStreamHeader(domain string) string {
+	var to strings.Builder
+	_ = xml.EscapeText(&to, []byte(domain))
+	return fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' version='1.0' xmlns='jabber:client' xmlns:stream='%s'>", to.String(), xmppStreamNS)
+}
+
+// reads opening header of server stream and stream features, that must offer STARTTLS
+func readXMPPFeatures(d *xml.Decoder) error {
+	stream, err := nextStartElement(d)
+	if err != nil {
+		return err
+	}
+	if stream.Name.Space != xmppStreamNS || stream.Name.Local != "stream" {
+		return fmt.Errorf("xmpp: unexpected stream header: <%s>", stream.Name.Local)
+	}
+
+	features, err := nextStartElement(d)
+	if err != nil {
+		return err
+	}
+	if features.Name.Space != xmppStreamNS || features.Name.Local != "features" {
+		return fmt.Errorf("xmpp: unexpected element instead of stream features: <%s>", features.Name.Local)
+	}
+
+	var offered struct {
+		StartTLS *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	}
+	if err := d.DecodeElement(&offered, &features); err != nil {
+		return err
+	}
+	if offered.StartTLS == nil {
+		return errors.New("xmpp: server does not offer STARTTLS")
+	}
+	return nil
+}
+
+// reads reply to starttls command: proceed, or failure
+func readXMPPProceed(d *xml.Decoder) error {
+	reply, err := nextStartElement(d)
+	if err != nil {
+		return err
+	}
+	if reply.Name.Space == xmppTLSNS && reply.Name.Local == "proceed" {
+		return nil
+	}
+	return fmt.Errorf("xmpp: STARTTLS refused: <%s>", reply.Name.Local)
+}
+
+// skips declarations, comments and whitespace, up to the next opening element.
+// closing element means that server has closed the stream
+func nextStartElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return xml.StartElement{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, fmt.Errorf("xmpp: stream closed by server: </%s>", t.Name.Local)
+		}
+	}
+}
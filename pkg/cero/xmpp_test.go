@@ -0,0 +1,112 @@
+package cero
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// responses of servers, recorded up to the start of TLS handshake
+const (
+	xmppServerHeader   = `<?xml version='1.0'?><stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' id='5e1ec7a1' from='example.com' version='1.0' xml:lang='en'>`
+	xmppFeaturesTLS    = `<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>SCRAM-SHA-1</mechanism></mechanisms></stream:features>`
+	xmppFeaturesNoTLS  = `<stream:features><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism></mechanisms></stream:features>`
+	xmppProceed        = `<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>`
+	xmppFailure        = `<failure xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:stream>`
+	xmppHostUnknown    = `<stream:error><host-unknown xmlns='urn:ietf:params:xml:ns:xmpp-streams'/></stream:error></stream:stream>`
+	xmppStartTLSClient = `<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>`
+)
+
+func Test_xmppNegotiator(t *testing.T) {
+	header := xmppStreamHeader("example.com")
+	tests := []struct {
+		name        string
+		server      string
+		wantWritten string
+		wantErr     bool
+	}{
+		{"proceed", xmppServerHeader + "\n" + xmppFeaturesTLS + xmppProceed, header + xmppStartTLSClient, false},
+		{"failure", xmppServerHeader + xmppFeaturesTLS + xmppFailure, header + xmppStartTLSClient, true},
+		{"no starttls feature", xmppServerHeader + xmppFeaturesNoTLS, header, true},
+		{"stream error", xmppServerHeader + xmppHostUnknown, header, true},
+		{"closed", xmppServerHeader, header, true},
+		{"not xmpp", "220 ESMTP\r\n", header, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{server: strings.NewReader(tt.server)}
+			err := xmppNegotiator{}.negotiate(conn, "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("negotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantWritten, conn.written.String())
+		})
+	}
+}
+
+func Test_xmppStreamHeader(t *testing.T) {
+	assert.Equal(t,
+		`<?xml version='1.0'?><stream:stream to='example.com' version='1.0' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'>`,
+		xmppStreamHeader("example.com"))
+
+	// domain can not break out of attribute
+	assert.Contains(t, xmppStreamHeader("a'b"), "to='a&#39;b'")
+}
+
+func TestGrabCert_xmpp(t *testing.T) {
+	cert, key := newTestCert(t, &x509.Certificate{DNSNames: []string{"chat.example.com"}}, nil, nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// server records stream header of client, then upgrades connection to TLS
+	headers := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if _, err := r.ReadString('>'); err != nil { // XML declaration
+			return
+		}
+		header, err := r.ReadString('>')
+		if err != nil {
+			return
+		}
+		headers <- header
+
+		if _, err := conn.Write([]byte(xmppServerHeader + xmppFeaturesTLS)); err != nil {
+			return
+		}
+		if _, err := r.ReadString('>'); err != nil { // starttls
+			return
+		}
+		if _, err := conn.Write([]byte(xmppProceed)); err != nil {
+			return
+		}
+		_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}).Handshake()
+	}()
+
+	// stream is addressed to domain of target
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	result, err := GrabCert(context.Background(), net.JoinHostPort("chat.example.com", port), &Options{STARTTLS: "xmpp", LookupIPAddr: lookup, Timeout: 2 * time.Second})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"chat.example.com"}, result.Names)
+		assert.Contains(t, <-headers, "to='chat.example.com'")
+	}
+}
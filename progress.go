@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// targets known to be processed (CIDR sizes are known up front), sent to workers and processed by them
+// (shared by input goroutines and workers)
+var knownTargets, enqueuedTargets, doneTargets uint64
+
+// returns number of targets to process: known ones, except skipped because of -max limit and duplicates
+func totalTargets() uint64 {
+	total := satSub(atomic.LoadUint64(&knownTargets), atomic.LoadUint64(&skippedTargets))
+	return satSub(total, atomic.LoadUint64(&duplicateTargets))
+}
+
+// interval of progress reports
+var progressInterval = 2 * time.Second
+
+// reports progress to stderr every interval, until done is closed.
+// every report is written with a single write, so it does not interleave with lines of verbose errors
+func reportProgress(start time.Time, done chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintln(os.Stderr, progressLine(atomic.LoadUint64(&doneTargets), atomic.LoadUint64(&enqueuedTargets), totalTargets(), time.Since(start)))
+		case <-done:
+			return
+		}
+	}
+}
+
+// formats progress: 'progress: done/total targets done, N enqueued, rate/s, ETA duration'.
+// ETA is estimated only when total is known
+func progressLine(done, enqueued, total uint64, elapsed time.Duration) string {
+	rate := float64(done) / elapsed.Seconds()
+	if total == 0 || total == math.MaxUint64 {
+		return fmt.Sprintf("progress: %d targets done, %d enqueued, %.0f/s", done, enqueued, rate)
+	}
+
+	eta := "unknown"
+	if rate > 0 {
+		eta = time.Duration(float64(satSub(total, done)) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("progress: %d/%d targets done, %d enqueued, %.0f/s, ETA %s", done, total, enqueued, rate, eta)
+}
+
+// adds n to counter (saturating, IPv6 CIDRs are huge)
+func satAddCounter(counter *uint64, n uint64) {
+	for {
+		old := atomic.LoadUint64(counter)
+		if atomic.CompareAndSwapUint64(counter, old, satAdd(old, n)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_progressLine(t *testing.T) {
+	cases := []struct {
+		done, enqueued, total uint64
+		elapsed               time.Duration
+		expected              string
+	}{
+		{100, 150, 1000, 10 * time.Second, "progress: 100/1000 targets done, 150 enqueued, 10/s, ETA 1m30s"},
+		{0, 100, 1000, time.Second, "progress: 0/1000 targets done, 100 enqueued, 0/s, ETA unknown"},
+		{100, 100, 0, 2 * time.Second, "progress: 100 targets done, 100 enqueued, 50/s"},
+		{100, 100, math.MaxUint64, 2 * time.Second, "progress: 100 targets done, 100 enqueued, 50/s"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, progressLine(c.done, c.enqueued, c.total, c.elapsed))
+	}
+}
+
+func Test_main_progress(t *testing.T) {
+	// server that stalls handshake for a while, so that progress is reported at least once
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	progressInterval = 10 * time.Millisecond
+	defer func() { progressInterval = 2 * time.Second }()
+
+	os.Args = []string{"cero-test", "-progress", "-c", "1", "-p", tsURL.Port(), tsURL.Hostname() + "/31"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "/2 targets done, ")
+	assert.True(t, strings.Contains(output, "example.com"), output)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scripted exchange of plaintext server: expected client line (empty to skip reading) and server reply
+type scriptStep struct {
+	expect string
+	reply  string
+}
+
+// helper utility to start plaintext server, that negotiates with client and then upgrades connection to TLS
+// (unless negotiation returns false)
+func newSTARTTLSServer(t *testing.T, negotiate func(conn net.Conn) bool) net.Listener {
+	cert := newTestCertificate(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "mail.example.com"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if negotiate(conn) {
+					_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// negotiation of line-based protocol, following the script
+func scriptNegotiator(script []scriptStep) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		r := textproto.NewReader(bufio.NewReader(conn))
+		for _, step := range script {
+			if step.expect != "" {
+				line, err := r.ReadLine()
+				if err != nil || !strings.HasPrefix(line, step.expect) {
+					return false
+				}
+			}
+			if _, err := conn.Write([]byte(step.reply)); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Test_main_starttlsSMTP(t *testing.T) {
+	ln := newSTARTTLSServer(t, scriptNegotiator([]scriptStep{
+		{"", "220 mail.example.com ESMTP\r\n"},
+		{"EHLO ", "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n"},
+		{"STARTTLS", "220 2.0.0 Ready to start TLS\r\n"},
+	}))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-starttls", "smtp", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "mail.example.com", strings.TrimSpace(output))
+}
+
+func Test_main_starttlsSMTP_refused(t *testing.T) {
+	ln := newSTARTTLSServer(t, scriptNegotiator([]scriptStep{
+		{"", "220 mail.example.com ESMTP\r\n"},
+		{"EHLO ", "250 mail.example.com\r\n"},
+		{"STARTTLS", "502 5.5.1 STARTTLS not supported\r\n"},
+	}))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-v", "-starttls", "smtp", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "STARTTLS not supported")
+}
+
+func Test_main_starttlsDefaultPort(t *testing.T) {
+	os.Args = []string{"cero-test", "-v", "-starttls", "smtp", "127.0.0.1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.True(t, strings.HasPrefix(output, "127.0.0.1:587 -- "), output)
+}
+
+func Test_main_starttlsIMAP(t *testing.T) {
+	ln := newSTARTTLSServer(t, scriptNegotiator([]scriptStep{
+		{"", "* OK IMAP4rev1 Service Ready\r\n"},
+		{"a001 STARTTLS", "* CAPABILITY IMAP4rev1\r\na001 OK Begin TLS negotiation now\r\n"},
+	}))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-starttls", "imap", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "mail.example.com", strings.TrimSpace(output))
+}
+
+func Test_main_starttlsIMAP_refused(t *testing.T) {
+	ln := newSTARTTLSServer(t, scriptNegotiator([]scriptStep{
+		{"", "* OK IMAP4rev1 Service Ready\r\n"},
+		{"a001 STARTTLS", "a001 BAD STARTTLS not supported\r\n"},
+	}))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-v", "-starttls", "imap", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "imap: STARTTLS refused: a001 BAD STARTTLS not supported")
+}
+
+// SSLRequest message of PostgreSQL protocol
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xD2, 0x16, 0x2F}
+
+// negotiation of PostgreSQL SSLRequest, replying with reply byte
+func postgresServerNegotiation(reply byte) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil || !bytes.Equal(request, postgresSSLRequest) {
+			return false
+		}
+		if _, err := conn.Write([]byte{reply}); err != nil {
+			return false
+		}
+		return reply == 'S'
+	}
+}
+
+func Test_main_starttlsPostgres(t *testing.T) {
+	ln := newSTARTTLSServer(t, postgresServerNegotiation('S'))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-starttls", "postgres", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Equal(t, "mail.example.com", strings.TrimSpace(output))
+}
+
+func Test_main_starttlsPostgres_refused(t *testing.T) {
+	ln := newSTARTTLSServer(t, postgresServerNegotiation('N'))
+	defer ln.Close()
+
+	os.Args = []string{"cero-test", "-v", "-starttls", "postgres", ln.Addr().String()}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "postgres: server does not support TLS")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+)
+
+// counters of the run, accumulated by result-processing worker
+type runStats struct {
+	start      time.Time
+	targets    uint64
+	successful uint64
+	errors     map[string]uint64   // by class
+	names      map[string]struct{} // normalized
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		start:  time.Now(),
+		errors: make(map[string]uint64),
+		names:  make(map[string]struct{}),
+	}
+}
+
+// counts processed result
+func (s *runStats) add(result *procResult) {
+	s.targets++
+	if result.err != nil {
+		s.errors[cero.ClassifyError(result.err)]++
+		return
+	}
+	s.successful++
+	for _, name := range result.names {
+		if name != "" {
+			s.names[normalizeName(name)] = struct{}{}
+		}
+	}
+}
+
+// formats summary of the run:
+// 'N targets, N successful, N errors (class: N, ...), N unique names, duration'
+func (s *runStats) String() string {
+	var total uint64
+	var classes []string
+	for _, class := range cero.ErrorClasses {
+		if n := s.errors[class]; n > 0 {
+			total += n
+			classes = append(classes, fmt.Sprintf("%s: %d", class, n))
+		}
+	}
+
+	errors := fmt.Sprintf("%d errors", total)
+	if len(classes) > 0 {
+		errors += " (" + strings.Join(classes, ", ") + ")"
+	}
+
+	return fmt.Sprintf("%d targets, %d successful, %s, %d unique names, %s",
+		s.targets, s.successful, errors, len(s.names), time.Since(s.start).Round(time.Millisecond))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runStats(t *testing.T) {
+	stats := newRunStats()
+	assert.True(t, strings.HasPrefix(stats.String(), "0 targets, 0 successful, 0 errors, 0 unique names, "), stats.String())
+
+	stats.add(&procResult{names: []string{"example.com", "www.example.com"}})
+	stats.add(&procResult{names: []string{"Example.com.", "api.example.com"}})
+	stats.add(&procResult{err: syscall.ECONNREFUSED})
+	stats.add(&procResult{err: syscall.ECONNREFUSED})
+	stats.add(&procResult{err: context.Canceled})
+	stats.add(&procResult{err: errors.New("unknown")})
+
+	assert.True(t, strings.HasPrefix(stats.String(), "6 targets, 2 successful, 4 errors (refused: 2, cancelled: 1, other: 1), 3 unique names, "), stats.String())
+}
+
+func Test_main_stats(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	os.Args = []string{"cero-test", "-stats", tsURL.Host, "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output := captureOutput(main)
+	assert.Contains(t, output, "\n2 targets, 1 successful, 1 errors (refused: 1), 2 unique names, ")
+
+	// no summary by default
+	os.Args = []string{"cero-test", tsURL.Host}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	output = captureOutput(main)
+	assert.NotContains(t, output, "targets")
+}
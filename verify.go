@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/glebarez/cero/pkg/cero"
+)
+
+// verification error of self-signed leaf, that is not trusted
+var errSelfSigned = errors.New("self-signed certificate")
+
+// verifies certificate chain, presented by remote host, against roots (system ones if nil).
+// chain[0] is considered to be a leaf, the rest of the chain is used as intermediates.
+// if host is a domain name, leaf is also checked to be valid for this name.
+// returns nil if chain is valid
+func verifyChain(chain []*x509.Certificate, host string, roots *x509.CertPool) error {
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	// bare IPs are not checked against the certificate
+	if net.ParseIP(host) == nil {
+		opts.DNSName = host
+	}
+
+	_, err := chain[0].Verify(opts)
+
+	// untrusted leaf, that is its own issuer (unlike root CA, presented in chain after leaf)
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) && cero.IsSelfSigned(chain[0]) {
+		return fmt.Errorf("%w: %w", errSelfSigned, err)
+	}
+	return err
+}
+
+// loads PEM bundle of CA certificates
+func loadRoots(path string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return roots, nil
+}
+
+// translates chain verification error into a short human-readable reason
+func verifyReason(err error) string {
+	if err == nil {
+		return "valid"
+	}
+
+	var (
+		invalidErr   x509.CertificateInvalidError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		criticalErr  x509.UnhandledCriticalExtension
+		algErr       x509.InsecureAlgorithmError
+		rootsErr     x509.SystemRootsError
+	)
+
+	switch {
+	case errors.Is(err, errSelfSigned):
+		return "self-signed"
+	case errors.As(err, &invalidErr):
+		switch invalidErr.Reason {
+		case x509.Expired:
+			// the same reason is used for not-yet-valid certificates
+			if invalidErr.Cert != nil && time.Now().Before(invalidErr.Cert.NotBefore) {
+				return "not yet valid"
+			}
+			return "expired"
+		case x509.NotAuthorizedToSign:
+			return "not authorized to sign"
+		case x509.TooManyIntermediates:
+			return "too many intermediates"
+		case x509.IncompatibleUsage:
+			return "incompatible usage"
+		case x509.NameMismatch:
+			return "issuer name mismatch"
+		case x509.CANotAuthorizedForThisName, x509.CANotAuthorizedForExtKeyUsage,
+			x509.NameConstraintsWithoutSANs, x509.UnconstrainedName, x509.TooManyConstraints:
+			return "constraints violation"
+		default:
+			return "invalid certificate"
+		}
+	case errors.As(err, &authorityErr):
+		return "untrusted root"
+	case errors.As(err, &hostnameErr):
+		return "hostname mismatch"
+	case errors.As(err, &criticalErr):
+		return "unhandled critical extension"
+	case errors.As(err, &algErr):
+		return "insecure algorithm"
+	case errors.As(err, &rootsErr):
+		return "system roots unavailable"
+	}
+	return "other"
+}
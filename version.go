@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// build metadata, set at release with -ldflags "-X main.version=... -X main.commit=...".
+// if not set, they are taken from build info, embedded by go build and go install
+var (
+	version string
+	commit  string
+)
+
+// returns 'cero VERSION (commit COMMIT, GOVERSION)', with unknown parts omitted
+func versionString() string {
+	v, c, modified := version, commit, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// module version is set by go install module@version, (devel) otherwise
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if c == "" {
+					c = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if v == "" {
+		v = "devel"
+	}
+	s := "cero " + v + " ("
+	if c != "" {
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if modified {
+			c += "-dirty"
+		}
+		s += fmt.Sprintf("commit %s, ", c)
+	}
+	return s + runtime.Version() + ")"
+}
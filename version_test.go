@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_versionString(t *testing.T) {
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+
+	version, commit = "v1.2.3", "0123456789abcdef0123"
+	s := versionString()
+	assert.True(t, strings.HasPrefix(s, "cero v1.2.3 (commit 0123456789ab"), s)
+	assert.True(t, strings.HasSuffix(s, runtime.Version()+")"), s)
+
+	// test binary has no module version
+	version, commit = "", ""
+	assert.True(t, strings.HasPrefix(versionString(), "cero devel ("))
+}
+
+func Test_main_version(t *testing.T) {
+	os.Args = []string{"cero-test", "-version", "127.0.0.1:1"}
+	flag.CommandLine = flag.NewFlagSet("", flag.ExitOnError)
+
+	// targets are not processed
+	assert.Equal(t, versionString()+"\n", captureOutput(main))
+}